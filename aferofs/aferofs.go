@@ -0,0 +1,122 @@
+// Expose a http.FileSystem, like the ones of ghfs, as read-only afero.Fs.
+// A package of its own, so importing ghfs doesn't depend on afero.
+package aferofs
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Expose a http.FileSystem as read-only afero.Fs. Writes fail with
+// syscall.EROFS
+func New(hfs http.FileSystem) afero.Fs {
+	return aferofs{hfs}
+}
+
+type aferofs struct {
+	hfs http.FileSystem
+}
+
+func readOnly(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: syscall.EROFS}
+}
+
+func (a aferofs) Name() string {
+	return "ghfs"
+}
+func (a aferofs) Open(name string) (afero.File, error) {
+	f, err := a.hfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return aferoFile{File: f, name: name}, nil
+}
+func (a aferofs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, readOnly("open", name)
+	}
+	return a.Open(name)
+}
+func (a aferofs) Stat(name string) (os.FileInfo, error) {
+	f, err := a.hfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+func (a aferofs) Create(name string) (afero.File, error) {
+	return nil, readOnly("open", name)
+}
+func (a aferofs) Mkdir(name string, perm os.FileMode) error {
+	return readOnly("mkdir", name)
+}
+func (a aferofs) MkdirAll(name string, perm os.FileMode) error {
+	return readOnly("mkdir", name)
+}
+func (a aferofs) Remove(name string) error {
+	return readOnly("remove", name)
+}
+func (a aferofs) RemoveAll(name string) error {
+	return readOnly("remove", name)
+}
+func (a aferofs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EROFS}
+}
+func (a aferofs) Chmod(name string, mode os.FileMode) error {
+	return readOnly("chmod", name)
+}
+func (a aferofs) Chown(name string, uid, gid int) error {
+	return readOnly("chown", name)
+}
+func (a aferofs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return readOnly("chtimes", name)
+}
+
+type aferoFile struct {
+	http.File
+	name string
+}
+
+func (f aferoFile) Name() string {
+	return f.name
+}
+func (f aferoFile) ReadAt(buf []byte, off int64) (int, error) {
+	if ra, ok := f.File.(io.ReaderAt); ok {
+		return ra.ReadAt(buf, off)
+	}
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrInvalid}
+}
+func (f aferoFile) Readdirnames(count int) ([]string, error) {
+	if d, ok := f.File.(interface {
+		Readdirnames(int) ([]string, error)
+	}); ok {
+		return d.Readdirnames(count)
+	}
+	fis, err := f.Readdir(count)
+	names := make([]string, len(fis))
+	for i, fi := range fis {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
+func (f aferoFile) Write([]byte) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+func (f aferoFile) WriteAt([]byte, int64) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+func (f aferoFile) WriteString(string) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+func (f aferoFile) Truncate(int64) error {
+	return readOnly("truncate", f.name)
+}
+func (f aferoFile) Sync() error {
+	return nil
+}
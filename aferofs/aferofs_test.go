@@ -0,0 +1,74 @@
+package aferofs
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestAfero(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "d/b.txt", "d/c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	afs := New(http.Dir(dir))
+
+	data, err := afero.ReadFile(afs, "/d/b.txt")
+	if err != nil || string(data) != "d/b.txt" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	fi, err := afs.Stat("/a.txt")
+	if err != nil || fi.Size() != 5 {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+	fis, err := afero.ReadDir(afs, "/d")
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	if err != nil || !reflect.DeepEqual(names, []string{"b.txt", "c.txt"}) {
+		t.Errorf("ReadDir = %v, %v", names, err)
+	}
+	if _, err := afs.Stat("/nope"); !os.IsNotExist(err) {
+		t.Errorf("Stat of a missing file = %v", err)
+	}
+
+	f, err := afs.Open("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 3)
+	if n, err := f.ReadAt(buf, 2); err != nil || string(buf[:n]) != "txt" {
+		t.Errorf("ReadAt = %q, %v", buf[:n], err)
+	}
+
+	writes := map[string]error{
+		"OpenFile": func() error { _, err := afs.OpenFile("/a.txt", os.O_RDWR, 0); return err }(),
+		"Create":   func() error { _, err := afs.Create("/new"); return err }(),
+		"Mkdir":    afs.Mkdir("/e", 0755),
+		"Remove":   afs.Remove("/a.txt"),
+		"Rename":   afs.Rename("/a.txt", "/b.txt"),
+		"Chmod":    afs.Chmod("/a.txt", 0600),
+		"Write":    func() error { _, err := f.Write([]byte("x")); return err }(),
+	}
+	for op, err := range writes {
+		if !errors.Is(err, syscall.EROFS) {
+			t.Errorf("%s: got %v, want %v", op, err, syscall.EROFS)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "a.txt" {
+		t.Errorf("a.txt was modified: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,138 @@
+package ghfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Write the tree of fs below root to w as a tar archive, like git archive
+// does. Modes, ModTimes and symlinks are preserved. Blobs are streamed to
+// w one at a time
+func Tar(w io.Writer, fs http.FileSystem, root string) error {
+	root = path.Clean("/" + root)
+	tw := tar.NewWriter(w)
+	err := Walk(fs, root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, ok := archivePath(root, name, fi)
+		if !ok {
+			return nil
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = readlink(fs, name); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return errors.Wrapf(err, "Cannot create header for %s.", name)
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(tw, fs, name)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Write the tree of fs below root to w as a zip archive. Entries carry
+// the ModTime and mode of the files, symlinks store their target as
+// content. Blobs are streamed to w one at a time
+func Zip(w io.Writer, fs http.FileSystem, root string) error {
+	root = path.Clean("/" + root)
+	zw := zip.NewWriter(w)
+	err := Walk(fs, root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, ok := archivePath(root, name, fi)
+		if !ok {
+			return nil
+		}
+
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return errors.Wrapf(err, "Cannot create header for %s.", name)
+		}
+		hdr.Name = rel
+		if !fi.IsDir() {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := readlink(fs, name)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, link)
+			return err
+		case fi.Mode().IsRegular():
+			return copyFile(fw, fs, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Name of the file at name in an archive of the cleaned path root.
+// Directories end with a slash. Reports false for root itself
+func archivePath(root, name string, fi os.FileInfo) (string, bool) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+	if rel == "" {
+		return "", false
+	}
+	if fi.IsDir() {
+		rel += "/"
+	}
+	return rel, true
+}
+
+func copyFile(w io.Writer, fs http.FileSystem, name string) error {
+	f, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := copyBuffer(w, f); err != nil {
+		return errors.Wrapf(err, "Cannot copy %s.", name)
+	}
+	return nil
+}
+
+func readlink(fs http.FileSystem, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	l, ok := f.(Linker)
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+	}
+	return l.Readlink()
+}
@@ -0,0 +1,69 @@
+package ghfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	g "github.com/gogits/git"
+)
+
+// Listings and archives of the same tree are byte-identical with a constant
+// WithModTime, even for commits made at different times
+func TestReproducibleOutput(t *testing.T) {
+	files := map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c": "c", "link@": "a.txt"}
+	modTime := WithModTime(func(*g.TreeEntry) time.Time { return fixtureTime })
+
+	var outputs []map[string][]byte
+	for run := 0; run < 2; run++ {
+		f := newFixture(t)
+		// Move the commit time of the second run
+		f.commits = 24 * run
+		for name, content := range files {
+			f.write(name, content)
+		}
+		commit := f.commit("Commit")
+
+		out := map[string][]byte{}
+		for _, fs := range []struct {
+			name string
+			hfs  http.FileSystem
+		}{
+			{"FromCommit", FromCommit(commit, modTime)},
+			{"FromTree", FromTree(&commit.Tree, modTime)},
+		} {
+			hfs := fs.hfs
+			var tar, zip bytes.Buffer
+			if err := Tar(&tar, hfs, "/"); err != nil {
+				t.Fatal(err)
+			}
+			if err := Zip(&zip, hfs, "/"); err != nil {
+				t.Fatal(err)
+			}
+			out[fs.name+" tar"] = tar.Bytes()
+			out[fs.name+" zip"] = zip.Bytes()
+
+			h := Handler(hfs, WithJSONListings())
+			for _, p := range []string{"/", "/dir/"} {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", p+"?format=json", nil))
+				out[fs.name+" listing of "+p] = w.Body.Bytes()
+				w = httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+				out[fs.name+" HTML listing of "+p] = append(w.Body.Bytes(), w.Header().Get("Last-Modified")...)
+			}
+		}
+		outputs = append(outputs, out)
+	}
+
+	for name, first := range outputs[0] {
+		if len(first) == 0 {
+			t.Errorf("%s: no output", name)
+		}
+		if !bytes.Equal(first, outputs[1][name]) {
+			t.Errorf("%s differs between runs:\n%s\n%s", name, first, outputs[1][name])
+		}
+	}
+}
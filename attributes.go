@@ -0,0 +1,137 @@
+package ghfs
+
+import (
+	"bufio"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The .gitattributes attribute setting the Content-Type of served files,
+// e.g. "*.wasm ghfs-content-type=application/wasm"
+const ContentTypeAttribute = "ghfs-content-type"
+
+// Set the Content-Type of files from the ContentTypeAttribute in
+// .gitattributes files of the tree, overriding detection by extension
+func WithContentTypeAttribute() HandlerOption {
+	return func(h *handler) {
+		h.attrs = &attributes{dirs: map[string][]attrRule{}}
+	}
+}
+
+type attrRule struct {
+	pattern string
+	attrs   map[string]string
+}
+
+// Parsed .gitattributes files, cached per directory
+type attributes struct {
+	mu   sync.Mutex
+	dirs map[string][]attrRule
+}
+
+// Look up the value of attr for the file at name. Like git, rules of
+// deeper .gitattributes files and later lines take precedence. Unset
+// attributes are reported as missing
+func (a *attributes) get(fs http.FileSystem, name, attr string) (string, bool) {
+	name = strings.TrimPrefix(name, "/")
+	dirs := []string{""}
+	for i, c := range name {
+		if c == '/' {
+			dirs = append(dirs, name[:i])
+		}
+	}
+
+	value, ok := "", false
+	for _, dir := range dirs {
+		rel := strings.TrimPrefix(name[len(dir):], "/")
+		for _, rule := range a.rules(fs, dir) {
+			v, set := rule.attrs[attr]
+			if set && matchAttrPattern(rule.pattern, rel) {
+				value, ok = v, v != ""
+			}
+		}
+	}
+	return value, ok
+}
+
+func (a *attributes) rules(fs http.FileSystem, dir string) []attrRule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if rules, ok := a.dirs[dir]; ok {
+		return rules
+	}
+	rules := readAttributes(unhide(fs), path.Join("/", dir, ".gitattributes"))
+	a.dirs[dir] = rules
+	return rules
+}
+
+// Parse a .gitattributes file. Unset (-attr) and unspecified (!attr)
+// attributes map to an empty value, set attributes without value to
+// "true"
+func readAttributes(fs http.FileSystem, name string) []attrRule {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []attrRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rule := attrRule{pattern: fields[0], attrs: map[string]string{}}
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "-"), strings.HasPrefix(field, "!"):
+				rule.attrs[field[1:]] = ""
+			case strings.Contains(field, "="):
+				kv := strings.SplitN(field, "=", 2)
+				rule.attrs[kv[0]] = kv[1]
+			default:
+				rule.attrs[field] = "true"
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Match a gitattributes pattern against a slash separated path relative
+// to the directory of the .gitattributes file. Patterns without a slash
+// match the base name at any depth, others match the whole path and may
+// use ** to match any number of directories
+func matchAttrPattern(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,284 @@
+package ghfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+var (
+	// Returned by history operations of filesystems without a commit
+	ErrNoCommit = errors.New("Filesystem has no commit")
+	// Returned by history operations if the tree of WithSubtree is not
+	// part of the commit
+	ErrNotSubtree = errors.New("Tree is not part of the commit")
+	// Returned by history operations if the tree of WithSubtree is found
+	// at several paths of the commit, whose histories may differ
+	ErrAmbiguousSubtree = errors.New("Tree found at several paths of the commit")
+)
+
+// A line of a file with the commit that last changed it
+type BlameLine struct {
+	SHA    string
+	Author string
+	Email  string
+	When   time.Time
+	Line   string
+}
+
+// Results of Blame, cached per path
+type blames struct {
+	mu    sync.Mutex
+	lines map[string]*blameLines
+}
+
+// Result of Blame for a path, computed once. Concurrent calls for the
+// same path wait for the first one, other paths are computed in parallel
+type blameLines struct {
+	once  sync.Once
+	lines []BlameLine
+	err   error
+}
+
+// Path of the served subtree in the tree of the commit, looked up once
+// and shared by the copies of a filesystem
+type subtreePath struct {
+	once   sync.Once
+	prefix string
+	err    error
+}
+
+// Path of name in the tree of the commit, which differs from name when
+// serving a subtree
+func (fs ghfs) commitPath(name string) (string, error) {
+	if fs.tree == &fs.commit.Tree {
+		return name, nil
+	}
+	fs.subtree.once.Do(func() {
+		id := fs.tree.Id.String()
+		switch paths := treePaths(&fs.commit.Tree, id, "", nil); len(paths) {
+		case 0:
+			fs.subtree.err = errors.Wrap(ErrNotSubtree, id)
+		case 1:
+			fs.subtree.prefix = paths[0]
+		default:
+			fs.subtree.err = errors.Wrapf(ErrAmbiguousSubtree, "%s at %s and %s", id, paths[0], paths[1])
+		}
+	})
+	return path.Join(fs.subtree.prefix, name), fs.subtree.err
+}
+
+// Report the commit that last changed each line of the file at name.
+// History is followed along first parents of the served commit, lines
+// are matched between versions along a shortest edit script. Results are
+// cached per path
+func (fs ghfs) Blame(name string) ([]BlameLine, error) {
+	if fs.commit == nil || fs.blames == nil {
+		return nil, ErrNoCommit
+	}
+	name, ok := cleanPath(name)
+	if !ok {
+		return nil, &os.PathError{Op: "blame", Path: name, Err: os.ErrNotExist}
+	}
+
+	fs.blames.mu.Lock()
+	b, ok := fs.blames.lines[name]
+	if !ok {
+		b = &blameLines{}
+		fs.blames.lines[name] = b
+	}
+	fs.blames.mu.Unlock()
+
+	b.once.Do(func() {
+		cpath, err := fs.commitPath(name)
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.lines, b.err = fs.blame(cpath)
+		if b.err != nil {
+			b.err = fs.mapError(b.err)
+		}
+	})
+	if b.err != nil {
+		return nil, b.err
+	}
+	return append([]BlameLine{}, b.lines...), nil
+}
+func (fs ghfs) blame(name string) ([]BlameLine, error) {
+	commit := fs.commit
+	entry, err := commit.GetTreeEntryByPath(name)
+	switch {
+	case err == g.ErrNotExist:
+		return nil, &os.PathError{Op: "blame", Path: name, Err: os.ErrNotExist}
+	case err != nil:
+		return nil, errors.Wrap(err, "Cannot get entry.")
+	case entry.Type != g.ObjectBlob:
+		return nil, &os.PathError{Op: "blame", Path: name, Err: os.ErrInvalid}
+	}
+	lines, err := fs.readLines(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lines of the current version whose commit is not known yet,
+	// with their index in the served version
+	type line struct{ cur, served int }
+	pending := make([]line, len(lines))
+	for i := range pending {
+		pending[i] = line{i, i}
+	}
+	owners := make([]*g.Commit, len(lines))
+
+	cur, curLines := commit, lines
+	for len(pending) > 0 {
+		parent, pentry := parentEntry(cur, name)
+		if pentry == nil {
+			for _, l := range pending {
+				owners[l.served] = cur
+			}
+			break
+		}
+		if pentry.Id == entry.Id {
+			cur = parent
+			continue
+		}
+
+		plines, err := fs.readLines(pentry)
+		if err != nil {
+			return nil, err
+		}
+		match := matchLines(plines, curLines)
+		var next []line
+		for _, l := range pending {
+			if m := match[l.cur]; m >= 0 {
+				next = append(next, line{m, l.served})
+			} else {
+				owners[l.served] = cur
+			}
+		}
+		pending, cur, entry, curLines = next, parent, pentry, plines
+	}
+
+	ret := make([]BlameLine, len(lines))
+	for i, c := range owners {
+		ret[i] = BlameLine{
+			SHA:    c.Id.String(),
+			Author: c.Author.Name,
+			Email:  c.Author.Email,
+			When:   c.Author.When,
+			Line:   strings.TrimSuffix(lines[i], "\n"),
+		}
+	}
+	return ret, nil
+}
+
+// Return the first parent of commit and its blob at name. The entry is
+// nil if there is no parent or the blob doesn't exist in it
+func parentEntry(commit *g.Commit, name string) (*g.Commit, *g.TreeEntry) {
+	if commit.ParentCount() == 0 {
+		return nil, nil
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return nil, nil
+	}
+	entry, err := parent.GetTreeEntryByPath(name)
+	if err != nil || entry.Type != g.ObjectBlob {
+		return parent, nil
+	}
+	return parent, entry
+}
+
+// Read a blob split into lines, keeping the line endings
+func (fs ghfs) readLines(entry *g.TreeEntry) ([]string, error) {
+	rc, err := fs.cache.Data(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot read blob.")
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
+
+// Match the lines of b to equal lines of a along a shortest edit script
+// (Myers' algorithm). Unmatched lines of b are -1
+func matchLines(a, b []string) []int {
+	n, m := len(a), len(b)
+	match := make([]int, m)
+	for i := range match {
+		match[i] = -1
+	}
+
+	// v[off+k] is the furthest x on diagonal k. trace[d] holds v for the
+	// diagonals -d..d before step d
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int
+	x, y := 0, 0
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int{}, v[off-d:off+d+1]...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	x, y = n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		vd := trace[d]
+		at := func(k int) int { return vd[k+d] }
+		k := x - y
+		var pk int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := at(pk)
+		py := px - pk
+		for x > px && y > py {
+			x--
+			y--
+			match[y] = x
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		match[y] = x
+	}
+	return match
+}
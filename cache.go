@@ -0,0 +1,143 @@
+package ghfs
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// A size bounded LRU cache of blob contents keyed by object id. It is safe
+// for concurrent use and can be shared by several filesystems
+type BlobCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	items    map[string]*list.Element
+	hits     int64
+	misses   int64
+}
+
+type cachedBlob struct {
+	id   string
+	data []byte
+}
+
+// Create a cache holding at most maxBytes of blob contents. Blobs larger
+// than maxBytes are never cached
+func NewBlobCache(maxBytes int64) *BlobCache {
+	return &BlobCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+// Read blobs through cache
+func WithBlobCache(cache *BlobCache) Option {
+	return func(fs *ghfs) {
+		fs.cache = cache
+	}
+}
+
+// Return the number of cache hits and misses
+func (c *BlobCache) Stats() (hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Open the contents of a blob, from the cache if possible. A nil cache
+// reads straight from git
+func (c *BlobCache) Data(entry *g.TreeEntry) (io.ReadCloser, error) {
+	if c == nil || entrySize(entry) > c.maxBytes {
+		return blobData(entry)
+	}
+
+	id := entry.Id.String()
+	if data, ok := c.get(id); ok {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	rc, err := blobData(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot read blob.")
+	}
+	c.add(id, data)
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Return the cached contents of entry without reading git. Misses aren't
+// counted, as callers fall back to Data
+func (c *BlobCache) cached(entry *g.TreeEntry) ([]byte, bool) {
+	if c == nil || entrySize(entry) > c.maxBytes {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[entry.Id.String()]
+	if !ok {
+		return nil, false
+	}
+	c.hits++
+	cacheHits.Add(1)
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedBlob).data, true
+}
+
+// Open blob contents from git. Every read of blob data goes through here,
+// tests replace it to count and wrap the readers
+var blobData = func(entry *g.TreeEntry) (io.ReadCloser, error) {
+	rc, err := entry.Blob().Data()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot get Data()")
+	}
+	return rc, nil
+}
+
+func (c *BlobCache) get(id string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[id]
+	if !ok {
+		c.misses++
+		cacheMisses.Add(1)
+		return nil, false
+	}
+	c.hits++
+	cacheHits.Add(1)
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedBlob).data, true
+}
+
+func (c *BlobCache) add(id string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[id]; ok || int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.items[id] = c.lru.PushFront(&cachedBlob{id, data})
+	c.size += int64(len(data))
+
+	for c.size > c.maxBytes {
+		e := c.lru.Back()
+		b := e.Value.(*cachedBlob)
+		c.lru.Remove(e)
+		delete(c.items, b.id)
+		c.size -= int64(len(b.data))
+	}
+}
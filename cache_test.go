@@ -0,0 +1,46 @@
+package ghfs
+
+import (
+	"io/fs"
+	"testing"
+)
+
+func TestBlobCache(t *testing.T) {
+	files := map[string]string{
+		"a":   "aaaa",
+		"b":   "bbbb",
+		"c":   "cccc",
+		"big": "0123456789",
+	}
+	_, commit := newRepo(t, files)
+	cache := NewBlobCache(8)
+	fsys := FS(FromCommit(commit, WithBlobCache(cache)))
+
+	// a and b fill the cache, reading a again makes b the oldest, so c
+	// evicts b. big never fits
+	steps := []struct {
+		name         string
+		hits, misses int64
+	}{
+		{"a", 0, 1},
+		{"b", 0, 2},
+		{"a", 1, 2},
+		{"c", 1, 3},
+		{"a", 2, 3},
+		{"b", 2, 4},
+		{"big", 2, 4},
+		{"big", 2, 4},
+	}
+	for i, step := range steps {
+		data, err := fs.ReadFile(fsys, step.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != files[step.name] {
+			t.Errorf("%d: read %q from %s", i, data, step.name)
+		}
+		if hits, misses := cache.Stats(); hits != step.hits || misses != step.misses {
+			t.Errorf("%d: %s: %d hits, %d misses, want %d, %d", i, step.name, hits, misses, step.hits, step.misses)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ghfs
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type cacheRule struct {
+	pattern string
+	byType  bool
+	value   string
+}
+
+// Set Cache-Control to value for files matching pattern, which is matched
+// against the path like a .gitattributes pattern, e.g. "*.js" or
+// "assets/**". Rules of WithCacheControl and WithCacheControlType are
+// tried in order and the first match wins. Directories served with an
+// index.html get the value of their index file
+func WithCacheControl(pattern, value string) HandlerOption {
+	return func(h *handler) {
+		h.cacheRules = append(h.cacheRules, cacheRule{pattern: pattern, value: value})
+	}
+}
+
+// Set Cache-Control to value for files whose media type matches pattern,
+// e.g. "text/html" or "image/*". See WithCacheControl
+func WithCacheControlType(pattern, value string) HandlerOption {
+	return func(h *handler) {
+		h.cacheRules = append(h.cacheRules, cacheRule{pattern: pattern, byType: true, value: value})
+	}
+}
+
+// Set Cache-Control for the file at name, or the index.html of the
+// directory at name, from the first matching rule. Type rules don't match
+// HEAD requests for files whose type only their content can tell
+func (h *handler) setCacheControl(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) {
+	if len(h.cacheRules) == 0 {
+		return
+	}
+	fi, ok := stat(fs, name)
+	if !ok {
+		return
+	}
+	if fi.IsDir() {
+		name = path.Join(name, "index.html")
+		if fi, ok = stat(fs, name); !ok || fi.IsDir() {
+			return
+		}
+	}
+
+	rel := strings.TrimPrefix(name, "/")
+	mediaType, typed := "", false
+	for _, rule := range h.cacheRules {
+		if !rule.byType {
+			if matchAttrPattern(rule.pattern, rel) {
+				w.Header().Set("Cache-Control", rule.value)
+				return
+			}
+			continue
+		}
+
+		if !typed {
+			ctype, _ := h.responseType(r, fs, name)
+			mediaType, _, _ = mime.ParseMediaType(ctype)
+			typed = true
+		}
+		if ok, _ := path.Match(rule.pattern, mediaType); ok {
+			w.Header().Set("Cache-Control", rule.value)
+			return
+		}
+	}
+}
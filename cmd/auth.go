@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords by user. Plain text passwords from -auth are kept apart from
+// the htpasswd hashes, bcrypt ($2y$) or SHA-1 ({SHA}), so a password that
+// looks like a hash is still compared as plain text
+type credentials struct {
+	plain  map[string]string
+	hashes map[string]string
+}
+
+var bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
+// Report whether hash is a htpasswd hash check can verify
+func supportedHash(hash string) bool {
+	for _, prefix := range bcryptPrefixes {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(hash, "{SHA}")
+}
+
+// Parse a single "user:pass" pair
+func parseAuth(userpass string) (credentials, error) {
+	kv := strings.SplitN(userpass, ":", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return credentials{}, errors.New("Expected user:pass.")
+	}
+	return credentials{plain: map[string]string{kv[0]: kv[1]}}, nil
+}
+
+// Read the users of a htpasswd file. Blank lines and comments are skipped.
+// Only bcrypt and SHA-1 hashes are supported, other formats like MD5
+// ($apr1$), crypt(3) or plain text are rejected instead of being compared
+// as plain text
+func readHtpasswd(path string) (credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return credentials{}, errors.Wrap(err, "Cannot open htpasswd file.")
+	}
+	defer f.Close()
+
+	creds := credentials{hashes: map[string]string{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return credentials{}, errors.Errorf("Invalid htpasswd line %q.", line)
+		}
+		if !supportedHash(kv[1]) {
+			return credentials{}, errors.Errorf("Unsupported password hash for user %q, use bcrypt or SHA-1.", kv[0])
+		}
+		creds.hashes[kv[0]] = kv[1]
+	}
+	return creds, errors.Wrap(scanner.Err(), "Cannot read htpasswd file.")
+}
+
+func (c credentials) check(user, pass string) bool {
+	if stored, ok := c.plain[user]; ok {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(pass)) == 1
+	}
+	stored, ok := c.hashes[user]
+	if !ok {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(stored, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(pass)) == nil
+	case strings.HasPrefix(stored, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		pass = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(pass)) == 1
+}
+
+// Require HTTP basic auth with one of creds for every request
+func basicAuth(creds credentials, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !creds.check(user, pass) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ghfs", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
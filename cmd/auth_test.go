@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHtpasswd(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadHtpasswd(t *testing.T) {
+	path := writeHtpasswd(t, "# users\n\nalice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\nbob:$2y$05$c4WoMPo3SXsafkva.HHa6uXQZWr7oboPiC2bT/r7q1BB8I2s0BRqC\n")
+	creds, err := readHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds.hashes) != 2 {
+		t.Errorf("got %d users, want 2", len(creds.hashes))
+	}
+	if !creds.check("alice", "password") {
+		t.Error("SHA-1 password of alice not accepted")
+	}
+	if creds.check("alice", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=") {
+		t.Error("SHA-1 hash of alice accepted as password")
+	}
+	if creds.check("carol", "password") {
+		t.Error("unknown user accepted")
+	}
+}
+
+func TestReadHtpasswdUnsupported(t *testing.T) {
+	for _, line := range []string{
+		"alice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/",
+		"alice:$1$saltsalt$2vnaRpHa6Jxjz5n83ok8Z0",
+		"alice:$5$saltsalt$Gcm6FsVtF/Qa77ZKD.iwsJlCVPY0XSMgLJL0Hnww/c1",
+		"alice:rl0vDC8Bh.aI.",
+		"alice:password",
+	} {
+		if _, err := readHtpasswd(writeHtpasswd(t, line+"\n")); err == nil {
+			t.Errorf("%q: no error for unsupported hash", line)
+		}
+	}
+}
+
+func TestParseAuth(t *testing.T) {
+	creds, err := parseAuth("alice:secret:with:colons")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !creds.check("alice", "secret:with:colons") {
+		t.Error("password not accepted")
+	}
+	if creds.check("alice", "secret") {
+		t.Error("wrong password accepted")
+	}
+	// Plain text passwords are never taken for hashes
+	for _, pass := range []string{"$2secret", "$2y$05$c4WoMPo3SXsafkva.HHa6uXQZWr7oboPiC2bT/r7q1BB8I2s0BRqC", "{SHA}secret"} {
+		creds, err := parseAuth("alice:" + pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !creds.check("alice", pass) {
+			t.Errorf("%q: password not accepted", pass)
+		}
+		if creds.check("alice", "password") {
+			t.Errorf("%q: password of the hash accepted", pass)
+		}
+	}
+
+	for _, userpass := range []string{"alice", ":secret"} {
+		if _, err := parseAuth(userpass); err == nil {
+			t.Errorf("%q: no error", userpass)
+		}
+	}
+}
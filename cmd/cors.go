@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Answer cross-origin requests from origins, or from any origin if it
+// contains "*". Preflight requests are answered directly with methods and
+// headers, requests from other origins get no CORS headers
+func cors(origins []string, methods, headers string, next http.Handler) http.Handler {
+	allowed := func(origin string) bool {
+		for _, o := range origins {
+			if o == "*" || o == origin {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if allowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				if headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				w.Header().Set("Access-Control-Max-Age", "600")
+			} else {
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Length, Content-Range")
+			}
+		}
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Split a comma separated flag value, dropping empty elements
+func splitList(list string) []string {
+	var ret []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
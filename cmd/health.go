@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+
+	g "github.com/gogits/git"
+	"github.com/pkg/errors"
+)
+
+// Answer liveness checks at healthz and readiness checks at readyz with
+// 200 OK, or 503 Service Unavailable if ready fails. Other requests and
+// empty paths are passed to next
+func health(healthz, readyz string, ready func() error, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case healthz != "" && r.URL.Path == healthz:
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("ok\n"))
+		case readyz != "" && r.URL.Path == readyz:
+			w.Header().Set("Cache-Control", "no-store")
+			if err := ready(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok\n"))
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Check that the repository at path opens and branchname resolves to a
+// commit. An empty branchname only checks that the branches can be read
+func checkRepository(path, branchname string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "Cannot get absolute path.")
+	}
+	repo, err := g.OpenRepository(path)
+	if err != nil {
+		return errors.Wrap(err, "Cannot open repository.")
+	}
+	if branchname == "" {
+		_, err = repo.GetBranches()
+		return errors.Wrap(err, "Cannot get branches.")
+	}
+	_, err = repo.GetCommitIdOfBranch(branchname)
+	return errors.Wrap(err, "Cannot resolve branch.")
+}
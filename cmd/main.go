@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	g "github.com/gogits/git"
 	"github.com/lemmi/ghfs"
+	"github.com/pkg/errors"
 )
 
 func POE(err error, prefix ...interface{}) {
@@ -18,35 +30,245 @@ func POE(err error, prefix ...interface{}) {
 }
 
 type gitroot struct {
-	path, branchname string
+	repo       *g.Repository
+	branchname string
+
+	// Only accessed by update
+	commit string
+	// http.Handler of the current commit
+	current atomic.Value
 }
 
-func (gr gitroot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path, err := filepath.Abs(gr.path)
+func openRepository(path string) *g.Repository {
+	path, err := filepath.Abs(path)
 	POE(err, "Filepath")
 
 	repo, err := g.OpenRepository(path)
 	POE(err, "OpenRepository")
+	return repo
+}
+
+// Serve the branch and poll it for new commits every interval
+func newGitroot(path, branchname string, interval time.Duration) *gitroot {
+	repo := openRepository(path)
+	log.Print("On branch ", branchname)
+	gr := &gitroot{repo: repo, branchname: branchname}
+	POE(gr.update(), "LookupBranch")
+	go gr.watch(interval)
+	return gr
+}
+
+func (gr *gitroot) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := gr.update(); err != nil {
+			log.Print("LookupBranch: ", err)
+		}
+	}
+}
+
+// Swap the served tree if the branch moved
+func (gr *gitroot) update() error {
+	id, err := gr.repo.GetCommitIdOfBranch(gr.branchname)
+	if err != nil {
+		return err
+	}
+	if id == gr.commit {
+		return nil
+	}
+
+	commit, err := gr.repo.GetCommit(id)
+	if err != nil {
+		return err
+	}
+	log.Print("Serving tree of commit ", id)
+	gr.commit = id
+	gr.current.Store(http.FileServer(ghfs.FromCommit(commit)))
+	return nil
+}
 
-	commit, err := repo.GetCommitOfBranch(gr.branchname)
-	POE(err, "LookupBranch")
+func (gr *gitroot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gr.current.Load().(http.Handler).ServeHTTP(w, r)
+}
 
-	log.Print("On branch ", gr.branchname)
-	log.Print("Serving tree of commit ", commit.Id)
+// Serve the tree of every ref under /<ref>/ and a list of branches at /.
+// Branch names may contain slashes, the longest matching branch wins.
+// Tags and commit ids are matched by the first path segment
+type refroot struct {
+	repo *g.Repository
+}
 
-	http.FileServer(ghfs.FromCommit(commit)).ServeHTTP(w, r)
+func newRefroot(path string) *refroot {
+	return &refroot{repo: openRepository(path)}
+}
+
+func (rr *refroot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	branches, err := rr.repo.GetBranches()
+	if err != nil {
+		log.Print("GetBranches: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sort.Strings(branches)
+
+	upath := strings.TrimPrefix(r.URL.Path, "/")
+	if upath == "" {
+		serveBranches(w, branches)
+		return
+	}
+
+	ref := ""
+	for _, b := range branches {
+		if (upath == b || strings.HasPrefix(upath, b+"/")) && len(b) > len(ref) {
+			ref = b
+		}
+	}
+	if ref == "" {
+		ref = strings.SplitN(upath, "/", 2)[0]
+	}
+
+	fs, err := ghfs.FromRef(rr.repo, ref)
+	switch errors.Cause(err) {
+	case nil:
+	case ghfs.ErrNoSuchRef, ghfs.ErrNotCommit, ghfs.ErrNoSuchBranch, ghfs.ErrNoReflog:
+		http.NotFound(w, r)
+		return
+	default:
+		log.Print("FromRef: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if upath == ref {
+		// Keep relative links of the listing inside the ref
+		http.Redirect(w, r, "/"+ref+"/", http.StatusMovedPermanently)
+		return
+	}
+	http.StripPrefix("/"+ref, http.FileServer(fs)).ServeHTTP(w, r)
+}
+
+func serveBranches(w http.ResponseWriter, branches []string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, b := range branches {
+		u := url.URL{Path: "/" + b + "/"}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(b))
+	}
+	fmt.Fprintf(w, "</pre>\n")
 }
 
 func main() {
 	log.SetFlags(log.Flags() | log.Lshortfile)
-	path := "."
-	branchname := "master"
-	if len(os.Args) > 1 {
-		path = os.Args[1]
+
+	path := flag.String("repo", ".", "path of the git repository, bare or with working tree")
+	branchname := flag.String("branch", "master", "branch to serve")
+	all := flag.Bool("all", false, "serve all branches under /<branch>/ instead of a single one")
+	addr := flag.String("addr", ":8008", "address to listen on, :443 with -autocert")
+	poll := flag.Duration("poll", 2*time.Second, "interval to check the branch for new commits")
+	logRequests := flag.Bool("log", false, "log every request")
+	auth := flag.String("auth", "", "require basic auth with user:pass, defaults to $GHFS_AUTH")
+	htpasswd := flag.String("htpasswd", "", "require basic auth with the users of a htpasswd file (bcrypt or SHA-1)")
+	corsOrigins := flag.String("cors-origins", "", "allow cross-origin requests from these comma separated origins, * for any")
+	corsMethods := flag.String("cors-methods", "GET, HEAD, OPTIONS", "methods allowed for cross-origin requests")
+	corsHeaders := flag.String("cors-headers", "", "request headers allowed for cross-origin requests")
+	healthz := flag.String("healthz", "/healthz", "path of the liveness check, empty to disable")
+	readyz := flag.String("readyz", "/readyz", "path of the readiness check, which resolves the branch, empty to disable")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS with this certificate file, requires -tls-key")
+	tlsKey := flag.String("tls-key", "", "private key file of -tls-cert")
+	autocertHosts := flag.String("autocert", "", "serve HTTPS with Let's Encrypt certificates for these comma separated hosts")
+	autocertDir := flag.String("autocert-dir", "autocert", "directory to cache the certificates of -autocert in")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time to let requests finish on SIGINT or SIGTERM")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\nServe the tree of git branches over http.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// Read after parsing, so -h does not print the credentials
+	if *auth == "" {
+		*auth = os.Getenv("GHFS_AUTH")
 	}
-	if len(os.Args) > 2 {
-		branchname = os.Args[2]
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(flag.CommandLine.Output(), "-tls-cert and -tls-key must be given together")
+		os.Exit(2)
+	}
+	if *autocertHosts != "" {
+		explicit := false
+		flag.Visit(func(f *flag.Flag) {
+			explicit = explicit || f.Name == "addr"
+		})
+		var err error
+		if *addr, err = autocertAddr(*addr, explicit); err != nil {
+			fmt.Fprintln(flag.CommandLine.Output(), err)
+			os.Exit(2)
+		}
 	}
 
-	http.ListenAndServe(":8008", gitroot{path, branchname})
+	var handler http.Handler
+	if *all {
+		handler = newRefroot(*path)
+	} else {
+		handler = newGitroot(*path, *branchname, *poll)
+	}
+	switch {
+	case *htpasswd != "":
+		creds, err := readHtpasswd(*htpasswd)
+		POE(err, "Htpasswd")
+		handler = basicAuth(creds, handler)
+	case *auth != "":
+		creds, err := parseAuth(*auth)
+		POE(err, "Auth")
+		handler = basicAuth(creds, handler)
+	}
+	// Preflight requests carry no credentials
+	if origins := splitList(*corsOrigins); len(origins) > 0 {
+		handler = cors(origins, *corsMethods, *corsHeaders, handler)
+	}
+	readyBranch := *branchname
+	if *all {
+		readyBranch = ""
+	}
+	handler = health(*healthz, *readyz, func() error {
+		return checkRepository(*path, readyBranch)
+	}, handler)
+	if *logRequests {
+		handler = accessLog(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: *addr, Handler: handler}
+	serve, acme := listener(srv, *tlsCert, *tlsKey, *autocertHosts, *autocertDir)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		stop()
+
+		log.Print("Shutting down, waiting up to ", *shutdownTimeout, " for requests to finish")
+		sctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if acme != nil {
+			if err := acme.Shutdown(sctx); err != nil {
+				acme.Close()
+			}
+		}
+		if err := srv.Shutdown(sctx); err != nil {
+			log.Print("Shutdown: ", err)
+			srv.Close()
+			return
+		}
+		log.Print("All requests finished")
+	}()
+
+	log.Print("Listening on ", *addr)
+	if err := serve(); err != http.ErrServerClosed {
+		POE(err, "ListenAndServe")
+	}
+	<-done
 }
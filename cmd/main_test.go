@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Create a repository at dir with the branches and tags of refs. Every
+// ref gets a commit with a.txt containing its name, refs ending in
+// "^{tag}" are created as tags
+func writeRepo(t *testing.T, dir string, refs ...string) map[string]string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=ghfs", "GIT_AUTHOR_EMAIL=ghfs@example.com",
+			"GIT_COMMITTER_NAME=ghfs", "GIT_COMMITTER_EMAIL=ghfs@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	git("init", "-q", "-b", "master")
+	ids := map[string]string{}
+	for i, ref := range refs {
+		name := strings.TrimSuffix(ref, "^{tag}")
+		git("checkout", "-q", "--orphan", fmt.Sprint("tmp", i))
+		git("rm", "-rfq", "--ignore-unmatch", ".")
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Looks like the path of a branch named like this one plus /x
+		if err := os.MkdirAll(filepath.Join(dir, "x"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "x", "a.txt"), []byte(name+"/x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", name)
+		ids[name] = git("rev-parse", "HEAD")
+		if name != ref {
+			git("tag", name)
+		} else {
+			git("branch", "-f", name)
+		}
+	}
+	git("checkout", "-q", "master")
+	for i := range refs {
+		git("branch", "-D", fmt.Sprint("tmp", i))
+	}
+	return ids
+}
+
+func TestRefroot(t *testing.T) {
+	dir := t.TempDir()
+	ids := writeRepo(t, dir, "master", "feature/x", "release", "v1^{tag}")
+	rr := newRefroot(dir)
+
+	for _, test := range []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/", http.StatusOK, `<a href="/feature/x/">feature/x</a>` + "\n" + `<a href="/master/">master</a>` + "\n" + `<a href="/release/">release</a>`, ""},
+		{"/master/a.txt", http.StatusOK, "master", ""},
+		// Branches with a slash match more than the first segment
+		{"/feature/x/a.txt", http.StatusOK, "feature/x", ""},
+		{"/feature/x/x/a.txt", http.StatusOK, "feature/x/x", ""},
+		{"/feature/a.txt", http.StatusNotFound, "", ""},
+		{"/release/x/a.txt", http.StatusOK, "release/x", ""},
+		{"/v1/a.txt", http.StatusOK, "v1", ""},
+		{"/" + ids["release"][:7] + "/a.txt", http.StatusOK, "release", ""},
+		{"/master", http.StatusMovedPermanently, "", "/master/"},
+		{"/feature/x", http.StatusMovedPermanently, "", "/feature/x/"},
+		{"/master/", http.StatusOK, `<a href="a.txt">a.txt</a>`, ""},
+		{"/nope/a.txt", http.StatusNotFound, "", ""},
+		{"/master/nope", http.StatusNotFound, "", ""},
+		{"/master@{9}/a.txt", http.StatusNotFound, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		rr.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("GET %s = %d, %q, want %d, %q", test.path, w.Code, w.Body, test.code, test.body)
+		}
+		if loc := w.Header().Get("Location"); loc != test.location {
+			t.Errorf("GET %s: Location %q, want %q", test.path, loc, test.location)
+		}
+	}
+}
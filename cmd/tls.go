@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Return the function serving srv: plain HTTP by default, HTTPS with the
+// given certificate files, or with certificates from Let's Encrypt for the
+// comma separated hosts. For the latter, ACME challenges and redirects to
+// HTTPS are served on :80 by the returned server, which is to be shut down
+// together with srv. It is nil otherwise. Certificates are cached in
+// cacheDir
+func listener(srv *http.Server, certFile, keyFile, hosts, cacheDir string) (func() error, *http.Server) {
+	switch {
+	case hosts != "":
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(splitList(hosts)...),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		srv.TLSConfig = m.TLSConfig()
+		acme := &http.Server{Addr: ":80", Handler: m.HTTPHandler(nil)}
+		return func() error {
+			go func() {
+				if err := acme.ListenAndServe(); err != http.ErrServerClosed {
+					log.Print("ACME challenge server: ", err)
+				}
+			}()
+			return srv.ListenAndServeTLS("", "")
+		}, acme
+	case certFile != "" || keyFile != "":
+		return func() error { return srv.ListenAndServeTLS(certFile, keyFile) }, nil
+	default:
+		return srv.ListenAndServe, nil
+	}
+}
+
+// Return the address to serve -autocert on. The redirects of the server
+// on :80 and Let's Encrypt expect HTTPS on port 443, which is the default
+// unless addr was set explicitly
+func autocertAddr(addr string, explicit bool) (string, error) {
+	if !explicit {
+		return ":443", nil
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil || port != "443" {
+		return "", errors.Errorf("-autocert requires -addr with port 443, got %q.", addr)
+	}
+	return addr, nil
+}
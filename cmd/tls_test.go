@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAutocertAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		explicit bool
+		want     string
+		err      bool
+	}{
+		{":8008", false, ":443", false},
+		{":443", true, ":443", false},
+		{"192.0.2.1:443", true, "192.0.2.1:443", false},
+		{":8008", true, "", true},
+		{"443", true, "", true},
+	}
+	for _, test := range tests {
+		addr, err := autocertAddr(test.addr, test.explicit)
+		if addr != test.want || (err != nil) != test.err {
+			t.Errorf("autocertAddr(%q, %v) = %q, %v, want %q", test.addr, test.explicit, addr, err, test.want)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	srv := &http.Server{Addr: ":443"}
+	if _, acme := listener(srv, "", "", "example.com", t.TempDir()); acme == nil || acme.Addr != ":80" {
+		t.Errorf("autocert: got ACME server %v, want one on :80", acme)
+	}
+	if srv.TLSConfig == nil {
+		t.Error("autocert: no TLS config")
+	}
+	for _, files := range [][2]string{{"", ""}, {"cert.pem", "key.pem"}} {
+		if _, acme := listener(&http.Server{}, files[0], files[1], "", ""); acme != nil {
+			t.Errorf("%q: got ACME server %v, want none", files, acme)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ghfs
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Bodies smaller than this aren't worth compressing
+const gzipMinSize = 1024
+
+// Compress responses of next with gzip if the client accepts it and the
+// Content-Type is text-like. Responses that are already encoded, partial
+// or known to be smaller than 1KiB are passed through, as are responses
+// to HEAD requests. Strong ETags are weakened, since the compressed body
+// differs from the blob
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" || r.Method == http.MethodHead {
+			// Don't compress parts of a blob, nor bodies never sent
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, accept: acceptsEncoding(r, "gzip")}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+type gzipWriter struct {
+	http.ResponseWriter
+	accept  bool
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.decide(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+func (w *gzipWriter) Write(buf []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(buf)
+	}
+	return w.ResponseWriter.Write(buf)
+}
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// Start compressing if the response qualifies
+func (w *gzipWriter) decide(status int) {
+	w.decided = true
+
+	h := w.Header()
+	if status != http.StatusOK || h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if !w.accept {
+		return
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n < gzipMinSize {
+		return
+	}
+
+	h.Del("Content-Length")
+	h.Del("Accept-Ranges")
+	h.Set("Content-Encoding", "gzip")
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+// Report whether responses of Content-Type ctype are worth compressing
+func compressible(ctype string) bool {
+	mt, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		strings.HasSuffix(mt, "+json"),
+		strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/javascript", "application/xml",
+		"application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
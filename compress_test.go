@@ -0,0 +1,99 @@
+package ghfs
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	text := strings.Repeat("compressible text\n", 100)
+	f, commit := newRepo(t, map[string]string{
+		"big.txt":   text,
+		"small.txt": "small",
+		"big.bin":   text,
+	})
+	etag := `"` + f.git("rev-parse", "HEAD:big.txt") + `"`
+	h := Gzip(Handler(FromCommit(commit)))
+
+	tests := []struct {
+		method, path, rng string
+		accept            bool
+		status            int
+		gzip, vary        bool
+		etag              string
+	}{
+		{"GET", "/big.txt", "", true, http.StatusOK, true, true, "W/" + etag},
+		{"GET", "/big.txt", "", false, http.StatusOK, false, true, etag},
+		// Below gzipMinSize
+		{"GET", "/small.txt", "", true, http.StatusOK, false, true, ""},
+		// application/octet-stream
+		{"GET", "/big.bin", "", true, http.StatusOK, false, false, etag},
+		{"GET", "/big.txt", "bytes=0-99", true, http.StatusPartialContent, false, false, etag},
+		{"HEAD", "/big.txt", "", true, http.StatusOK, false, false, etag},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.accept {
+			r.Header.Set("Accept-Encoding", "gzip")
+		}
+		if test.rng != "" {
+			r.Header.Set("Range", test.rng)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		desc := test.method + " " + test.path + " " + test.rng
+		if !test.accept {
+			desc += " without gzip"
+		}
+
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", desc, w.Code, test.status)
+		}
+		if gz := w.Header().Get("Content-Encoding") == "gzip"; gz != test.gzip {
+			t.Errorf("%s: Content-Encoding %q, want gzip %v", desc, w.Header().Get("Content-Encoding"), test.gzip)
+		}
+		if vary := w.Header().Get("Vary") == "Accept-Encoding"; vary != test.vary {
+			t.Errorf("%s: Vary %q, want Accept-Encoding %v", desc, w.Header().Get("Vary"), test.vary)
+		}
+		if test.etag != "" && w.Header().Get("ETag") != test.etag {
+			t.Errorf("%s: ETag %s, want %s", desc, w.Header().Get("ETag"), test.etag)
+		}
+
+		body := w.Body.String()
+		if test.gzip {
+			if cl := w.Header().Get("Content-Length"); cl != "" {
+				t.Errorf("%s: Content-Length %s of the uncompressed body", desc, cl)
+			}
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Errorf("%s: %v", desc, err)
+				continue
+			}
+			data, err := io.ReadAll(zr)
+			if err != nil {
+				t.Errorf("%s: %v", desc, err)
+			}
+			body = string(data)
+		}
+		switch {
+		case test.method == "HEAD":
+			if body != "" {
+				t.Errorf("%s: body %q", desc, body)
+			}
+		case test.rng != "":
+			if body != text[:100] {
+				t.Errorf("%s: body %q, want %q", desc, body, text[:100])
+			}
+		case test.path == "/small.txt":
+			if body != "small" {
+				t.Errorf("%s: body %q", desc, body)
+			}
+		case body != text:
+			t.Errorf("%s: body of %d bytes, want %d", desc, len(body), len(text))
+		}
+	}
+}
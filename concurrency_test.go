@@ -0,0 +1,103 @@
+package ghfs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Hammer one filesystem and handler from many goroutines. Run with -race
+// to check the lazily built state shared by the copies of a filesystem
+func TestConcurrentUse(t *testing.T) {
+	const nfiles = 50
+	name := func(i int) string {
+		return fmt.Sprintf("d%d/f%d.txt", i%5, i)
+	}
+	f := newFixture(t)
+	f.write(".gitattributes", "*.txt ghfs-content-type=text/x-test\n")
+	for i := 0; i < nfiles; i++ {
+		f.write(name(i), "first")
+	}
+	f.commit("First")
+	for i := 0; i < nfiles; i += 2 {
+		f.write(name(i), fmt.Sprint("content ", i))
+	}
+	commit := f.commit("Second")
+
+	// Without a path index every Open looks entries up in the trees of the
+	// commit, which share their *g.TreeEntry values
+	configs := []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"WithBlobCache", []Option{WithBlobCache(NewBlobCache(200))}},
+		{"all", []Option{WithBlobCache(NewBlobCache(200)), WithLastChangeModTime(), WithPathIndex(0)}},
+	}
+	for _, config := range configs {
+		t.Run(config.name, func(t *testing.T) {
+			hammer(t, FromCommit(commit, config.opts...), nfiles, name)
+		})
+	}
+}
+
+func hammer(t *testing.T, hfs http.FileSystem, nfiles int, name func(int) string) {
+	gfs := hfs.(GitFileSystem)
+	h := Gzip(Handler(hfs, WithContentTypeAttribute(), WithPrecompressed(), WithJSONListings()))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				n := (i + w) % nfiles
+				want := "first"
+				if n%2 == 0 {
+					want = fmt.Sprint("content ", n)
+				}
+
+				file, err := hfs.Open("/" + name(n))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data, err := io.ReadAll(file)
+				if err != nil || string(data) != want {
+					t.Errorf("%s: read %q, %v, want %q", name(n), data, err, want)
+				}
+				file.Close()
+
+				dir, err := hfs.Open(fmt.Sprintf("/d%d", n%5))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if fis, err := dir.Readdir(3); err != nil || len(fis) != 3 {
+					t.Errorf("Readdir(3) = %d entries, %v", len(fis), err)
+				}
+				dir.Close()
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", "/"+name(n), nil))
+				if w.Code != http.StatusOK || w.Body.String() != want || w.Header().Get("Content-Type") != "text/x-test" {
+					t.Errorf("GET %s = %d, %q, %s", name(n), w.Code, w.Body, w.Header().Get("Content-Type"))
+				}
+				w = httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", "/d1/?format=json", nil))
+				if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "f1.txt") {
+					t.Errorf("GET /d1/ = %d, %q", w.Code, w.Body)
+				}
+
+				if _, err := gfs.Blame(name(n)); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,86 @@
+package ghfs
+
+import (
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// Serve the tree of head, restricted to the files added or modified since
+// base and the directories containing them. Deleted files don't exist.
+// opts apply like for FromCommit
+func FromDiff(base, head *g.Commit, opts ...Option) (http.FileSystem, error) {
+	changed := map[string]bool{}
+	if _, err := diffTrees(&base.Tree, &head.Tree, "", changed); err != nil {
+		return nil, err
+	}
+	return filterfs{
+		fs: FromCommit(head, opts...),
+		keep: func(name string, _ os.FileInfo) bool {
+			return changed[name]
+		},
+	}, nil
+}
+
+// Add the paths of entries of head that differ from base to changed.
+// base may be nil. Reports whether anything changed
+func diffTrees(base, head *g.Tree, prefix string, changed map[string]bool) (bool, error) {
+	baseEntries := map[string]*g.TreeEntry{}
+	if base != nil {
+		scanner, err := base.Scanner()
+		if err != nil {
+			return false, errors.Wrap(err, "Cannot open scanner.")
+		}
+		for scanner.Scan() {
+			entry := scanner.TreeEntry()
+			baseEntries[entry.Name()] = entry
+		}
+		if err := scanner.Err(); err != nil {
+			return false, errors.Wrap(err, "Cannot scan tree.")
+		}
+	}
+
+	scanner, err := head.Scanner()
+	if err != nil {
+		return false, errors.Wrap(err, "Cannot open scanner.")
+	}
+	any := false
+	for scanner.Scan() {
+		entry := scanner.TreeEntry()
+		bentry := baseEntries[entry.Name()]
+		if bentry != nil && bentry.Id == entry.Id && bentry.Type == entry.Type {
+			continue
+		}
+
+		name := path.Join(prefix, entry.Name())
+		if entry.Type != g.ObjectTree {
+			changed[name] = true
+			any = true
+			continue
+		}
+
+		sub, err := head.SubTree(entry.Name())
+		if err != nil {
+			return false, errors.Wrap(err, "Cannot get subtree.")
+		}
+		var bsub *g.Tree
+		if bentry != nil && bentry.Type == g.ObjectTree {
+			if bsub, err = base.SubTree(entry.Name()); err != nil {
+				return false, errors.Wrap(err, "Cannot get subtree.")
+			}
+		}
+		subChanged, err := diffTrees(bsub, sub, name, changed)
+		if err != nil {
+			return false, err
+		}
+		if subChanged {
+			changed[name] = true
+			any = true
+		}
+	}
+	return any, errors.Wrap(scanner.Err(), "Cannot scan tree.")
+}
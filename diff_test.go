@@ -0,0 +1,54 @@
+package ghfs
+
+import (
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFromDiff(t *testing.T) {
+	f, base := newRepo(t, map[string]string{
+		"same": "s", "changed": "v1", "gone": "g", "d/same": "s", "d/changed": "v1", "kept/x": "x", "gonedir/x": "x",
+	})
+	f.write("changed", "v2")
+	f.write("d/changed", "v2")
+	f.write("new", "n")
+	f.write("newdir/y", "y")
+	f.remove("gone")
+	f.remove("gonedir/x")
+	head := f.commit("Change")
+
+	hfs, err := FromDiff(base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"changed": "v2", "d/changed": "v2", "new": "n", "newdir/y": "y"} {
+		data, err := fs.ReadFile(FS(hfs), name)
+		if err != nil || string(data) != want {
+			t.Errorf("ReadFile(%s) = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	for _, name := range []string{"/same", "/gone", "/d/same", "/kept", "/kept/x", "/gonedir", "/gonedir/x"} {
+		if f, err := hfs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Open(%s) = %v, want not exist", name, err)
+			if f != nil {
+				f.Close()
+			}
+		}
+	}
+	for dir, want := range map[string][]string{"/": {"changed", "d", "new", "newdir"}, "/d": {"changed"}} {
+		if got := readdirnames(t, hfs, dir); !reflect.DeepEqual(got, want) {
+			t.Errorf("Readdir of %s = %q, want %q", dir, got, want)
+		}
+	}
+
+	// Options apply to the served commit
+	hfs, err = FromDiff(base, head, WithDeny("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readdirnames(t, hfs, "/"), []string{"changed", "d", "newdir"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdir of / with WithDeny = %q, want %q", got, want)
+	}
+}
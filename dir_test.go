@@ -0,0 +1,147 @@
+package ghfs
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A directory listing a, b, c and d
+type pagedDir struct {
+	name string
+	hfs  http.FileSystem
+	dir  string
+}
+
+// Return a directory listing a, b, c and d for every implementation of
+// Readdir: a git tree, a filtered one that has to skip entries and an
+// overlay merging two trees
+func pagedDirs(t *testing.T) []pagedDir {
+	_, commit := newRepo(t, map[string]string{"d/a": "a", "d/b": "b", "d/c": "c", "d/d": "d"})
+	_, filtered := newRepo(t, map[string]string{
+		"d/a": "a", "d/askip": "", "d/b": "b", "d/c": "c", "d/cskip/x": "", "d/d": "d", "d/dskip": "",
+	})
+	_, upper := newRepo(t, map[string]string{"d/a": "a", "d/c": "c"})
+	_, lower := newRepo(t, map[string]string{"d/b": "b", "d/c": "lower", "d/d": "d"})
+
+	noSkip := func(name string, _ os.FileInfo) bool {
+		return !strings.HasSuffix(name, "skip")
+	}
+	return []pagedDir{
+		{"ghfsDir", FromCommit(commit), "/d"},
+		{"filterDir", filterfs{fs: FromCommit(filtered), keep: noSkip}, "/d"},
+		{"overlayDir", Overlay(FromCommit(upper), FromCommit(lower)), "/d"},
+	}
+}
+
+// Page through name with Readdir(count) until io.EOF and return the names
+func readdirPages(t *testing.T, hfs http.FileSystem, name string, count int) [][]string {
+	t.Helper()
+	f, err := hfs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var pages [][]string
+	for i := 0; ; i++ {
+		fis, err := f.Readdir(count)
+		page := []string{}
+		for _, fi := range fis {
+			page = append(page, fi.Name())
+		}
+		pages = append(pages, page)
+		if err != nil {
+			if err != io.EOF || len(fis) != 0 {
+				t.Errorf("Readdir(%d) of %s: %d entries, %v at the end, want 0, EOF", count, name, len(fis), err)
+			}
+			return pages
+		}
+		if i > 10 {
+			t.Fatalf("Readdir(%d) of %s: no end after %v", count, name, pages)
+		}
+	}
+}
+
+func TestReaddirPaging(t *testing.T) {
+	for _, d := range pagedDirs(t) {
+		want := [][]string{{"a", "b"}, {"c", "d"}, {}}
+		for run := 0; run < 2; run++ {
+			// The second run opens the directory again
+			if got := readdirPages(t, d.hfs, d.dir, 2); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: run %d: Readdir(2) pages = %q, want %q", d.name, run, got, want)
+			}
+		}
+	}
+}
+
+func TestReaddirEOF(t *testing.T) {
+	tests := []struct {
+		count int
+		want  [][]string
+	}{
+		{1, [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {}}},
+		{3, [][]string{{"a", "b", "c"}, {"d"}, {}}},
+		// The last page exactly fills count, the end is reported next
+		{4, [][]string{{"a", "b", "c", "d"}, {}}},
+		{5, [][]string{{"a", "b", "c", "d"}, {}}},
+	}
+	for _, d := range pagedDirs(t) {
+		for _, test := range tests {
+			if got := readdirPages(t, d.hfs, d.dir, test.count); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: Readdir(%d) pages = %q, want %q", d.name, test.count, got, test.want)
+			}
+		}
+
+		// A count <= 0 reports no error, even when exhausted
+		f, err := d.hfs.Open(d.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if fis, err := f.Readdir(-1); err != nil || len(fis) != 4*(1-i) {
+				t.Errorf("%s: Readdir(-1) #%d = %d entries, %v", d.name, i, len(fis), err)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestReaddirnames(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"d/a": "a", "d/b": "b", "d/c/x": "x", "d/d": "d", "d/hidden": ""})
+	f, err := FromCommit(commit, WithHiddenPrefix("hid")).Open("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, ok := f.(interface {
+		Readdirnames(int) ([]string, error)
+	})
+	if !ok {
+		t.Fatalf("%T has no Readdirnames", f)
+	}
+
+	want := [][]string{{"a", "b", "c"}, {"d"}}
+	for i, page := range want {
+		if names, err := d.Readdirnames(3); err != nil || !reflect.DeepEqual(names, page) {
+			t.Errorf("page %d = %q, %v, want %q", i, names, err, page)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if names, err := d.Readdirnames(3); err != io.EOF || len(names) != 0 {
+			t.Errorf("at the end = %q, %v, want EOF", names, err)
+		}
+	}
+	// Exhausted, but count <= 0 reports no error
+	if names, err := d.Readdirnames(-1); err != nil || len(names) != 0 {
+		t.Errorf("Readdirnames(-1) at the end = %q, %v", names, err)
+	}
+
+	// Names and Readdir agree
+	if got, want := readdirnames(t, FromCommit(commit, WithHiddenPrefix("hid")), "/d"), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdir names = %q, want %q", got, want)
+	}
+}
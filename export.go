@@ -0,0 +1,105 @@
+package ghfs
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Write the tree of fs to destDir, which is created if missing. Modes and
+// ModTimes are preserved and symlinks are recreated as symlinks. Existing
+// files are overwritten. Symlinks already below destDir are replaced, never
+// followed, so nothing is written outside of destDir
+func Export(fs http.FileSystem, destDir string) error {
+	type dirTime struct {
+		name    string
+		modTime time.Time
+	}
+	var dirs []dirTime
+
+	err := Walk(fs, "/", func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(destDir, filepath.FromSlash(name))
+
+		switch {
+		case fi.IsDir():
+			if err := exportDir(dst, name == "/", fi); err != nil {
+				return err
+			}
+			// Set after the content is written, which changes it
+			dirs = append(dirs, dirTime{dst, fi.ModTime()})
+			return nil
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := readlink(fs, name)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "Cannot replace file.")
+			}
+			return errors.Wrap(os.Symlink(target, dst), "Cannot create symlink.")
+		default:
+			return exportFile(fs, name, dst, fi)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].name, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return errors.Wrap(err, "Cannot set ModTime.")
+		}
+	}
+	return nil
+}
+
+// Create the directory dst. Below the root, anything else at dst is
+// removed first, so later writes cannot follow a symlink out of destDir
+func exportDir(dst string, root bool, fi os.FileInfo) error {
+	if root {
+		return errors.Wrap(os.MkdirAll(dst, fi.Mode().Perm()|0700), "Cannot create directory.")
+	}
+	cur, err := os.Lstat(dst)
+	switch {
+	case err == nil && cur.IsDir():
+		return nil
+	case err == nil:
+		if err := os.Remove(dst); err != nil {
+			return errors.Wrap(err, "Cannot replace file.")
+		}
+	case !os.IsNotExist(err):
+		return errors.Wrap(err, "Cannot stat directory.")
+	}
+	return errors.Wrap(os.Mkdir(dst, fi.Mode().Perm()|0700), "Cannot create directory.")
+}
+
+func exportFile(fs http.FileSystem, name, dst string, fi os.FileInfo) error {
+	// Replace instead of truncating, which would write through symlinks
+	// and hard links. O_EXCL fails if something reappears at dst
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Cannot replace file.")
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return errors.Wrap(err, "Cannot create file.")
+	}
+	if err := copyFile(f, fs, name); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "Cannot write file.")
+	}
+
+	// Not affected by the umask, unlike OpenFile
+	if err := os.Chmod(dst, fi.Mode().Perm()); err != nil {
+		return errors.Wrap(err, "Cannot set mode.")
+	}
+	return errors.Wrap(os.Chtimes(dst, fi.ModTime(), fi.ModTime()), "Cannot set ModTime.")
+}
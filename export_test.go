@@ -0,0 +1,77 @@
+package ghfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a": "1", "d/run*": "#!", "d/l@": "../a"})
+	fs := FromCommit(commit)
+	dir := t.TempDir()
+	// Exporting twice overwrites the first export
+	for i := 0; i < 2; i++ {
+		if err := Export(fs, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "d/run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 || !fi.ModTime().Equal(fixtureTime) {
+		t.Errorf("d/run: got mode %v, ModTime %v", fi.Mode(), fi.ModTime())
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "d/l")); err != nil || target != "../a" {
+		t.Errorf("d/l: got target %q, %v", target, err)
+	}
+	fi, err = os.Stat(filepath.Join(dir, "d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(fixtureTime) {
+		t.Errorf("d: got ModTime %v", fi.ModTime())
+	}
+}
+
+func TestExportReplacesSymlinks(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a": "1", "d/b": "2"})
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Left behind by an earlier export or planted by someone else
+	dir := t.TempDir()
+	if err := os.Symlink(victim, filepath.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "d")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Export(FromCommit(commit), dir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(victim); err != nil || string(b) != "keep" {
+		t.Errorf("file outside of destDir changed: %q, %v", b, err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "b")); !os.IsNotExist(err) {
+		t.Errorf("file written outside of destDir: %v", err)
+	}
+	for _, name := range []string{"a", "d"} {
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("%s is still a symlink", name)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "d/b")); err != nil || string(b) != "2" {
+		t.Errorf("d/b: got %q, %v", b, err)
+	}
+}
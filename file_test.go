@@ -0,0 +1,457 @@
+package ghfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Return n bytes of numbered lines, so every offset has distinct content
+func blobContent(n int) string {
+	var b strings.Builder
+	b.Grow(n + 16)
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, "%015d\n", i)
+	}
+	return b.String()[:n]
+}
+
+// Open name of hfs as a ghfsFile
+func openFile(tb testing.TB, hfs http.FileSystem, name string) *ghfsFile {
+	tb.Helper()
+	f, err := hfs.Open(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { f.Close() })
+	gf, ok := f.(*ghfsFile)
+	if !ok {
+		tb.Fatalf("%s: got %T, want *ghfsFile", name, f)
+	}
+	return gf
+}
+
+func TestReadAtConcurrent(t *testing.T) {
+	content := blobContent(1 << 20)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+	f := openFile(t, FromCommit(commit), "/blob")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			buf := make([]byte, 100)
+			for j := 0; j < 100; j++ {
+				off := rnd.Int63n(int64(len(content) - len(buf)))
+				n, err := f.ReadAt(buf, off)
+				if err != nil || n != len(buf) {
+					t.Errorf("ReadAt(%d) = %d, %v", off, n, err)
+					return
+				}
+				if want := content[off : off+int64(n)]; string(buf) != want {
+					t.Errorf("ReadAt(%d) = %q, want %q", off, buf, want)
+					return
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+}
+
+func TestReadAtStreamed(t *testing.T) {
+	content := blobContent(64 << 10)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+	f := openFile(t, FromCommit(commit, WithSeekBufferLimit(1<<10)), "/blob")
+
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(f, head); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		off  int64
+		size int
+		n    int
+		err  error
+	}{
+		{0, 100, 100, nil},
+		{40000, 100, 100, nil},
+		{1000, 100, 100, nil},
+		{int64(len(content)) - 50, 100, 50, io.EOF},
+		{int64(len(content)), 100, 0, io.EOF},
+		{int64(len(content)) + 10, 100, 0, io.EOF},
+	}
+	for _, test := range tests {
+		buf := make([]byte, test.size)
+		n, err := f.ReadAt(buf, test.off)
+		if n != test.n || err != test.err {
+			t.Errorf("ReadAt(%d) = %d, %v, want %d, %v", test.off, n, err, test.n, test.err)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		if want := content[test.off : test.off+int64(n)]; string(buf[:n]) != want {
+			t.Errorf("ReadAt(%d) = %q, want %q", test.off, buf[:n], want)
+		}
+	}
+	if f.data != nil {
+		t.Error("ReadAt of a streamed blob read it into memory")
+	}
+
+	// Read continues where it stopped before ReadAt
+	if _, err := io.ReadFull(f, head); err != nil {
+		t.Fatal(err)
+	}
+	if want := content[10:20]; string(head) != want {
+		t.Errorf("Read after ReadAt = %q, want %q", head, want)
+	}
+}
+
+// Many small ranges of a 100MB blob, read from an open file and served as
+// range requests with a blob cache
+func BenchmarkReadAtRanges(b *testing.B) {
+	const size = 100 << 20
+	const rangeSize = 4 << 10
+	_, commit := newRepo(b, map[string]string{"blob": blobContent(size)})
+	hfs := FromCommit(commit, WithSeekBufferLimit(size), WithBlobCache(NewBlobCache(size)))
+
+	b.Run("ReadAt", func(b *testing.B) {
+		f := openFile(b, hfs, "/blob")
+		buf := make([]byte, rangeSize)
+		rnd := rand.New(rand.NewSource(1))
+		b.ReportAllocs()
+		b.SetBytes(rangeSize)
+		for i := 0; i < b.N; i++ {
+			if _, err := f.ReadAt(buf, rnd.Int63n(size-rangeSize)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Range", func(b *testing.B) {
+		h := Handler(hfs)
+		rnd := rand.New(rand.NewSource(1))
+		b.ReportAllocs()
+		b.SetBytes(rangeSize)
+		for i := 0; i < b.N; i++ {
+			off := rnd.Int63n(size - rangeSize)
+			r, _ := http.NewRequest("GET", "/blob", nil)
+			r.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+rangeSize-1))
+			w := &discardWriter{header: http.Header{}}
+			h.ServeHTTP(w, r)
+			if w.status != http.StatusPartialContent || w.n != rangeSize {
+				b.Fatalf("bytes=%d-: status %d, %d bytes", off, w.status, w.n)
+			}
+		}
+	})
+}
+
+// A http.ResponseWriter counting the body instead of keeping it
+type discardWriter struct {
+	header http.Header
+	status int
+	n      int64
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+func (w *discardWriter) Write(buf []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	w.n += int64(len(buf))
+	return len(buf), nil
+}
+
+// Modes of reading a blob, buffered in memory or streamed from git
+var readModes = []struct {
+	name string
+	opt  Option
+}{
+	{"buffered", WithSeekBufferLimit(1 << 20)},
+	{"streamed", WithSeekBufferLimit(-1)},
+}
+
+// Replay the seeks of http.ServeContent, which probes the size with
+// SeekEnd before seeking back to the start or the range to serve
+func TestSeekEndProbe(t *testing.T) {
+	content := blobContent(100 << 10)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+
+	for _, mode := range readModes {
+		hfs := FromCommit(commit, mode.opt)
+		for _, start := range []int64{0, 10, 50 << 10} {
+			f := openFile(t, hfs, "/blob")
+			size, err := f.Seek(0, io.SeekEnd)
+			if err != nil || size != int64(len(content)) {
+				t.Fatalf("%s: Seek(0, SeekEnd) = %d, %v", mode.name, size, err)
+			}
+			if off, err := f.Seek(start, io.SeekStart); err != nil || off != start {
+				t.Fatalf("%s: Seek(%d, SeekStart) = %d, %v", mode.name, start, off, err)
+			}
+			data, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatalf("%s: %v", mode.name, err)
+			}
+			if string(data) != content[start:] {
+				t.Errorf("%s: read %d bytes from %d after SeekEnd, want %d", mode.name, len(data), start, len(content)-int(start))
+			}
+		}
+
+		r := httptest.NewRequest("GET", "/blob", nil)
+		w := httptest.NewRecorder()
+		Handler(hfs).ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != content {
+			t.Errorf("%s: GET /blob = %d, %d bytes", mode.name, w.Code, w.Body.Len())
+		}
+	}
+}
+
+// Stat and the size probe of http.ServeContent only need metadata
+func TestSeekEndReadsNoData(t *testing.T) {
+	content := blobContent(100 << 10)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+
+	for _, mode := range readModes {
+		reads := countBlobReads(t)
+		f := openFile(t, FromCommit(commit, mode.opt), "/blob")
+		fi, err := f.Stat()
+		if err != nil || fi.Size() != int64(len(content)) {
+			t.Fatalf("%s: Stat = %v, %v", mode.name, fi, err)
+		}
+		if size, err := f.Seek(0, io.SeekEnd); err != nil || size != int64(len(content)) {
+			t.Fatalf("%s: Seek(0, SeekEnd) = %d, %v", mode.name, size, err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if n := reads.Load(); n != 0 {
+			t.Errorf("%s: Stat and Seek read the blob %d times", mode.name, n)
+		}
+		if _, err := f.Read(make([]byte, 1)); err != nil {
+			t.Fatal(err)
+		}
+		if n := reads.Load(); n != 1 {
+			t.Errorf("%s: Read read the blob %d times, want 1", mode.name, n)
+		}
+	}
+}
+
+type seek struct {
+	offset int64
+	whence int
+}
+
+func TestSeek(t *testing.T) {
+	const size = 1000
+	content := blobContent(size)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+
+	tests := []struct {
+		name  string
+		read  int
+		seeks []seek
+		// Result of the last seek, or -1 for an error
+		want int64
+		// Offset the next Read starts at
+		pos int64
+	}{
+		{"start", 0, []seek{{0, io.SeekStart}}, 0, 0},
+		{"start forward", 0, []seek{{10, io.SeekStart}}, 10, 10},
+		{"start backward", 0, []seek{{500, io.SeekStart}, {100, io.SeekStart}}, 100, 100},
+		{"start after read", 20, []seek{{5, io.SeekStart}}, 5, 5},
+		{"start negative", 20, []seek{{-1, io.SeekStart}}, -1, 20},
+		{"current", 0, []seek{{0, io.SeekCurrent}}, 0, 0},
+		{"current after read", 20, []seek{{0, io.SeekCurrent}}, 20, 20},
+		{"current forward", 20, []seek{{5, io.SeekCurrent}}, 25, 25},
+		{"current backward", 0, []seek{{100, io.SeekStart}, {-50, io.SeekCurrent}}, 50, 50},
+		{"current to start", 20, []seek{{-20, io.SeekCurrent}}, 0, 0},
+		{"current negative", 0, []seek{{100, io.SeekStart}, {-101, io.SeekCurrent}}, -1, 100},
+		{"end", 0, []seek{{0, io.SeekEnd}}, size, size},
+		{"end backward", 0, []seek{{-10, io.SeekEnd}}, size - 10, size - 10},
+		{"end to start", 20, []seek{{-size, io.SeekEnd}}, 0, 0},
+		{"end negative", 0, []seek{{-size - 1, io.SeekEnd}}, -1, 0},
+		// Like os.File, positions past the end are valid and Read returns
+		// io.EOF
+		{"end past", 0, []seek{{10, io.SeekEnd}}, size + 10, size + 10},
+		{"end past after read", 20, []seek{{10, io.SeekEnd}}, size + 10, size + 10},
+		{"start past end", 0, []seek{{size + 10, io.SeekStart}}, size + 10, size + 10},
+		{"start at end", 0, []seek{{size, io.SeekStart}}, size, size},
+		{"current past end", 990, []seek{{20, io.SeekCurrent}}, size + 10, size + 10},
+		{"current past end twice", 0, []seek{{10, io.SeekEnd}, {10, io.SeekCurrent}}, size + 20, size + 20},
+		{"current back from past end", 0, []seek{{10, io.SeekEnd}, {-20, io.SeekCurrent}}, size - 10, size - 10},
+		{"start back from past end", 0, []seek{{10, io.SeekEnd}, {100, io.SeekStart}}, 100, 100},
+		{"current at end", 0, []seek{{0, io.SeekEnd}, {0, io.SeekCurrent}}, size, size},
+		{"current back from end", 0, []seek{{0, io.SeekEnd}, {-20, io.SeekCurrent}}, size - 20, size - 20},
+		{"start after end", 0, []seek{{0, io.SeekEnd}, {5, io.SeekStart}}, 5, 5},
+		{"invalid whence", 20, []seek{{0, 3}}, -1, 20},
+		{"negative whence", 20, []seek{{0, -1}}, -1, 20},
+	}
+	for _, mode := range readModes {
+		hfs := FromCommit(commit, mode.opt)
+		for _, test := range tests {
+			name := mode.name + ": " + test.name
+			f := openFile(t, hfs, "/blob")
+			if _, err := io.ReadFull(f, make([]byte, test.read)); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			var off int64
+			var err error
+			for _, s := range test.seeks {
+				off, err = f.Seek(s.offset, s.whence)
+			}
+			last := test.seeks[len(test.seeks)-1]
+			switch {
+			case test.want < 0 && err == nil:
+				t.Errorf("%s: Seek(%d, %d) = %d, want an error", name, last.offset, last.whence, off)
+			case test.want >= 0 && (err != nil || off != test.want):
+				t.Errorf("%s: Seek(%d, %d) = %d, %v, want %d", name, last.offset, last.whence, off, err, test.want)
+			}
+
+			buf := make([]byte, 10)
+			n, err := io.ReadFull(f, buf)
+			if test.pos >= size {
+				if n != 0 || err != io.EOF {
+					t.Errorf("%s: Read at %d = %d, %v, want 0, EOF", name, test.pos, n, err)
+				}
+				continue
+			}
+			if err != nil || string(buf) != content[test.pos:test.pos+10] {
+				t.Errorf("%s: Read = %q, %v, want %q", name, buf[:n], err, content[test.pos:test.pos+10])
+			}
+		}
+	}
+}
+
+// Return at most 7 bytes per Read, like a decompressing reader may
+type shortReader struct {
+	io.ReadCloser
+}
+
+func (r shortReader) Read(buf []byte) (int, error) {
+	if len(buf) > 7 {
+		buf = buf[:7]
+	}
+	return r.ReadCloser.Read(buf)
+}
+
+func TestShortReads(t *testing.T) {
+	content := blobContent(100 << 10)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+	wrapBlobData(t, func(rc io.ReadCloser) io.ReadCloser {
+		return shortReader{rc}
+	})
+
+	for _, mode := range readModes {
+		f := openFile(t, FromCommit(commit, mode.opt), "/blob")
+		pos := int64(0)
+		read := func(n int) {
+			t.Helper()
+			buf := make([]byte, n)
+			m, err := f.Read(buf)
+			if m != n || err != nil || string(buf) != content[pos:pos+int64(n)] {
+				t.Fatalf("%s: Read of %d bytes at %d = %d, %v", mode.name, n, pos, m, err)
+			}
+			pos += int64(n)
+			if off, err := f.Seek(0, io.SeekCurrent); err != nil || off != pos {
+				t.Fatalf("%s: offset after Read = %d, %v, want %d", mode.name, off, err, pos)
+			}
+		}
+		seek := func(offset int64, whence int, want int64) {
+			t.Helper()
+			if off, err := f.Seek(offset, whence); err != nil || off != want {
+				t.Fatalf("%s: Seek(%d, %d) = %d, %v, want %d", mode.name, offset, whence, off, err, want)
+			}
+			pos = want
+		}
+
+		read(1000)
+		read(3)
+		// Skip forward, far more than one short read
+		seek(12345, io.SeekStart, 12345)
+		read(1000)
+		seek(50000, io.SeekCurrent, 63345)
+		read(100)
+		// Backwards, which opens streamed blobs again
+		seek(10, io.SeekStart, 10)
+		read(64 << 10)
+		seek(-5, io.SeekEnd, int64(len(content))-5)
+		read(5)
+		if n, err := f.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+			t.Errorf("%s: Read at the end = %d, %v, want 0, EOF", mode.name, n, err)
+		}
+
+		buf := make([]byte, 1000)
+		if n, err := f.ReadAt(buf, 777); n != len(buf) || err != nil || string(buf) != content[777:1777] {
+			t.Errorf("%s: ReadAt(777) = %d, %v", mode.name, n, err)
+		}
+	}
+}
+
+func TestOpenContextCancel(t *testing.T) {
+	content := blobContent(100 << 10)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+
+	for _, mode := range readModes {
+		hfs := FromCommit(commit, mode.opt)
+		for _, open := range []struct {
+			name string
+			open func(context.Context) (http.File, error)
+		}{
+			{"OpenContext", func(ctx context.Context) (http.File, error) {
+				return hfs.(ContextFileSystem).OpenContext(ctx, "/blob")
+			}},
+			{"WithContext", func(ctx context.Context) (http.File, error) {
+				return WithContext(ctx, hfs).Open("/blob")
+			}},
+		} {
+			desc := mode.name + ": " + open.name
+			ctx, cancel := context.WithCancel(context.Background())
+			f, err := open.open(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 1000)
+			if n, err := f.Read(buf); n != len(buf) || err != nil {
+				t.Fatalf("%s: Read = %d, %v", desc, n, err)
+			}
+
+			cancel()
+			if mode.name == "streamed" {
+				if _, err := f.Read(buf); !errors.Is(err, context.Canceled) {
+					t.Errorf("%s: Read after cancel: got %v, want %v", desc, err, context.Canceled)
+				}
+			} else if n, err := f.Read(buf); n != len(buf) || err != nil {
+				// Buffered blobs were read completely by the first Read
+				t.Errorf("%s: Read of buffered blob after cancel = %d, %v", desc, n, err)
+			}
+			f.Close()
+
+			// Files opened with a done context fail on the first read
+			f, err = open.open(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Read(buf); !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: Read with done context: got %v, want %v", desc, err, context.Canceled)
+			}
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ghfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path"
+)
+
+// Serve only the paths of fs for which keep reports true. name is the
+// cleaned path without leading slash. Directory listings omit the
+// entries that are not kept and the root is always kept
+type filterfs struct {
+	fs   http.FileSystem
+	keep func(name string, fi os.FileInfo) bool
+}
+
+func (f filterfs) Open(name string) (http.File, error) {
+	return f.open(f.fs, name)
+}
+func (f filterfs) OpenContext(ctx context.Context, name string) (http.File, error) {
+	return f.open(WithContext(ctx, f.fs), name)
+}
+func (f filterfs) open(fs http.FileSystem, name string) (http.File, error) {
+	clean, ok := cleanPath(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: clean, Err: os.ErrNotExist}
+	}
+
+	file, err := fs.Open(withSlash(name, "/"+clean))
+	name = clean
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if name != "" && !f.keep(name, fi) {
+		file.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	if fi.IsDir() {
+		return &filterDir{File: file, name: name, keep: f.keep}, nil
+	}
+	return file, nil
+}
+
+type filterDir struct {
+	http.File
+	name string
+	keep func(name string, fi os.FileInfo) bool
+}
+
+func (d *filterDir) Readdir(count int) ([]os.FileInfo, error) {
+	ret := []os.FileInfo{}
+	for {
+		n := count
+		if count > 0 {
+			n = count - len(ret)
+		}
+		fis, err := d.File.Readdir(n)
+		for _, fi := range fis {
+			if d.keep(path.Join(d.name, fi.Name()), fi) {
+				ret = append(ret, fi)
+			}
+		}
+		if err == io.EOF && len(ret) > 0 {
+			// Report the end with the next call
+			err = nil
+		}
+		if err != nil || count <= 0 || len(fis) == 0 || len(ret) >= count {
+			return ret, err
+		}
+	}
+}
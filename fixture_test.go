@@ -0,0 +1,191 @@
+package ghfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	g "github.com/gogits/git"
+)
+
+// Commits of fixture repositories are dated fixtureTime plus one hour per
+// commit, so ids and times are the same on every run
+var fixtureTime = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// A git repository in a temporary directory, built with the git command
+type fixture struct {
+	tb      testing.TB
+	dir     string
+	commits int
+}
+
+// Create an empty repository with a master branch. Tests are skipped if
+// git is not installed
+func newFixture(tb testing.TB) *fixture {
+	tb.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		tb.Skip("git not installed")
+	}
+	f := &fixture{tb: tb, dir: tb.TempDir()}
+	f.git("init", "-q", "-b", "master")
+	return f
+}
+
+// Create a repository and commit files to it, see write
+func newRepo(tb testing.TB, files map[string]string) (*fixture, *g.Commit) {
+	tb.Helper()
+	f := newFixture(tb)
+	for name, content := range files {
+		f.write(name, content)
+	}
+	return f, f.commit("Initial commit")
+}
+
+// Run git in the repository and return its trimmed output
+func (f *fixture) git(args ...string) string {
+	f.tb.Helper()
+	return strings.TrimSpace(string(f.gitBytes(args...)))
+}
+
+// Run git in the repository and return its output
+func (f *fixture) gitBytes(args ...string) []byte {
+	f.tb.Helper()
+	return f.gitInput(nil, args...)
+}
+
+// Run git with stdin in the repository and return its output
+func (f *fixture) gitInput(stdin []byte, args ...string) []byte {
+	f.tb.Helper()
+	when := fixtureTime.Add(time.Duration(f.commits) * time.Hour).Format(time.RFC3339)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = f.dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=ghfs", "GIT_AUTHOR_EMAIL=ghfs@example.com", "GIT_AUTHOR_DATE="+when,
+		"GIT_COMMITTER_NAME=ghfs", "GIT_COMMITTER_EMAIL=ghfs@example.com", "GIT_COMMITTER_DATE="+when,
+	)
+	var stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		f.tb.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr.Bytes())
+	}
+	return out
+}
+
+// Write a file of the working tree. Names ending in "@" are created as
+// symlinks to content, names ending in "*" as executables
+func (f *fixture) write(name, content string) {
+	f.tb.Helper()
+	mode := os.FileMode(0644)
+	symlink := strings.HasSuffix(name, "@")
+	if strings.HasSuffix(name, "*") {
+		mode = 0755
+	}
+	name = strings.TrimRight(name, "@*")
+
+	p := filepath.Join(f.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		f.tb.Fatal(err)
+	}
+	os.Remove(p)
+	var err error
+	if symlink {
+		err = os.Symlink(content, p)
+	} else {
+		err = os.WriteFile(p, []byte(content), mode)
+	}
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// Remove a file or directory of the working tree
+func (f *fixture) remove(name string) {
+	f.tb.Helper()
+	if err := os.RemoveAll(filepath.Join(f.dir, filepath.FromSlash(name))); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// Add a submodule entry pointing to id at name without checking it out
+func (f *fixture) gitlink(name, id string) {
+	f.tb.Helper()
+	if err := os.MkdirAll(filepath.Join(f.dir, filepath.FromSlash(name)), 0755); err != nil {
+		f.tb.Fatal(err)
+	}
+	f.git("update-index", "--add", "--cacheinfo", fmt.Sprintf("160000,%s,%s", id, name))
+}
+
+// Commit the working tree and return the new commit
+func (f *fixture) commit(msg string) *g.Commit {
+	f.tb.Helper()
+	f.git("add", "-A")
+	f.git("commit", "-q", "--allow-empty", "-m", msg)
+	f.commits++
+	commit, err := f.repo().GetCommit(f.git("rev-parse", "HEAD"))
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return commit
+}
+
+// Write a loose object without referencing it and return its id
+func (f *fixture) writeObject(typ g.ObjectType, data []byte) string {
+	f.tb.Helper()
+	return strings.TrimSpace(string(f.gitInput(data, "hash-object", "-w", "--stdin", "-t", string(typ))))
+}
+
+// Open the repository
+func (f *fixture) repo() *g.Repository {
+	f.tb.Helper()
+	repo, err := g.OpenRepository(f.dir)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return repo
+}
+
+// Clone the repository into a bare repository and open it
+func (f *fixture) bare() *g.Repository {
+	f.tb.Helper()
+	dir := filepath.Join(f.tb.TempDir(), "bare.git")
+	f.git("clone", "-q", "--bare", f.dir, dir)
+	repo, err := g.OpenRepository(dir)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return repo
+}
+
+// Count the blob reads until the end of the test
+func countBlobReads(tb testing.TB) *atomic.Int64 {
+	var n atomic.Int64
+	wrapBlobData(tb, func(rc io.ReadCloser) io.ReadCloser {
+		n.Add(1)
+		return rc
+	})
+	return &n
+}
+
+// Pass the blob readers through wrap until the end of the test
+func wrapBlobData(tb testing.TB, wrap func(io.ReadCloser) io.ReadCloser) {
+	orig := blobData
+	blobData = func(entry *g.TreeEntry) (io.ReadCloser, error) {
+		rc, err := orig(entry)
+		if err != nil {
+			return nil, err
+		}
+		return wrap(rc), nil
+	}
+	tb.Cleanup(func() { blobData = orig })
+}
@@ -1,56 +1,147 @@
+// Implement the go http.FileSystem interface for a git tree.
+//
+// The Sys() method of FileInfos returned by the filesystems returns the
+// *g.TreeEntry of the file or directory, or the served *g.Tree for the
+// root directory.
+//
+// Repositories may be bare or have a working tree. Only the objects and
+// refs of the git directory are read, the working tree is never touched.
+//
+// Filesystems, BlobCaches and Handlers are safe for concurrent use. The
+// files returned by Open are not and must not be shared by goroutines.
 package ghfs
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	g "github.com/gogits/git"
 )
 
+// Readdir lists entries sorted lexicographically by name. Entries are read
+// on the first call and paged through by later calls. Every Open returns
+// a new ghfsDir, listing from the start
 type ghfsDir struct {
 	tree    *g.Tree
 	fi      os.FileInfo
 	scanner *g.TreeScanner
+	info    func(*g.TreeEntry) os.FileInfo
+	hide    func(*g.TreeEntry) bool
+	entries []*g.TreeEntry
+	pos     int
 }
 
-// Implement http.File on a git tree
+// Implement http.File on a git tree. Entries report the ModTime of fi, so
+// listings don't depend on the time they are made
 func NewDir(tree *g.Tree, fi os.FileInfo) (http.File, error) {
 	scanner, err := tree.Scanner()
 	if err != nil {
 		return nil, errors.Wrap(err, "Cannot open scanner.")
 	}
-	return &ghfsDir{tree: tree, fi: fi, scanner: scanner}, nil
+	info := func(entry *g.TreeEntry) os.FileInfo {
+		return modTimeFileInfo{FileInfo: entry, mode: entryMode(entry), modTime: fi.ModTime()}
+	}
+	return &ghfsDir{tree: tree, fi: fi, scanner: scanner, info: info}, nil
 }
+
 func (d *ghfsDir) Read([]byte) (int, error) {
-	return 0, io.EOF
+	return 0, &os.PathError{Op: "read", Path: d.fi.Name(), Err: ErrIsDir}
 }
 func (d *ghfsDir) Close() error {
 	return nil
 }
 func (d *ghfsDir) Readdir(count int) ([]os.FileInfo, error) {
-	ret := []os.FileInfo{}
-	for c := 0; count <= 0 || count > c; c++ {
-		if !d.scanner.Scan() {
-			break
+	page, err := d.page(count)
+	if page == nil {
+		return nil, err
+	}
+	ret := make([]os.FileInfo, len(page))
+	for i, entry := range page {
+		if d.info != nil {
+			ret[i] = d.info(entry)
+		} else {
+			ret[i] = entry
+		}
+	}
+	return ret, err
+}
+
+// Like Readdir, but only return the names of the entries, without
+// looking up their FileInfo
+func (d *ghfsDir) Readdirnames(count int) ([]string, error) {
+	page, err := d.page(count)
+	if page == nil {
+		return nil, err
+	}
+	names := make([]string, len(page))
+	for i, entry := range page {
+		names[i] = entry.Name()
+	}
+	return names, err
+}
+
+// Return the next count entries. Like os.File, return all remaining
+// entries if count <= 0, or io.EOF if count > 0 and there are none left
+func (d *ghfsDir) page(count int) ([]*g.TreeEntry, error) {
+	if d.entries == nil {
+		if err := d.readEntries(); err != nil {
+			return nil, err
 		}
-		ret = append(ret, d.scanner.TreeEntry())
 	}
-	return ret, d.scanner.Err()
+
+	n := len(d.entries) - d.pos
+	if count > 0 && count < n {
+		n = count
+	}
+	page := d.entries[d.pos : d.pos+n]
+	d.pos += n
+	if count > 0 && n == 0 {
+		return page, io.EOF
+	}
+	return page, nil
+}
+func (d *ghfsDir) readEntries() error {
+	// Non-nil even for an empty tree, which lists as ([], nil)
+	entries := []*g.TreeEntry{}
+	for d.scanner.Scan() {
+		entry := d.scanner.TreeEntry()
+		if d.hide != nil && d.hide(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := d.scanner.Err(); err != nil {
+		return errors.Wrap(err, "Cannot scan tree.")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	d.entries = entries
+	return nil
 }
 func (d *ghfsDir) Seek(int64, int) (int64, error) {
-	return 0, syscall.EISDIR
+	return 0, &os.PathError{Op: "seek", Path: d.fi.Name(), Err: ErrIsDir}
 }
 func (d *ghfsDir) Stat() (os.FileInfo, error) {
 	return d.fi, nil
 }
 
-type rootFileInfo struct{}
+type rootFileInfo struct {
+	tree    *g.Tree
+	modTime time.Time
+}
 
 func (r rootFileInfo) Name() string {
 	return ""
@@ -62,152 +153,1198 @@ func (r rootFileInfo) Mode() os.FileMode {
 	return os.ModeDir | 0755
 }
 func (r rootFileInfo) ModTime() time.Time {
-	return time.Now()
+	return r.modTime
 }
 func (r rootFileInfo) IsDir() bool {
 	return true
 }
 func (r rootFileInfo) Sys() interface{} {
-	return nil
+	return r.tree
+}
+
+// Implemented by the FileInfos of filesystems serving a git tree
+type GitFileInfo interface {
+	os.FileInfo
+	// Object id of the blob or tree
+	SHA() string
+	// Object type, g.ObjectCommit for submodules
+	Type() g.ObjectType
+}
+
+func (r rootFileInfo) SHA() string {
+	return r.tree.Id.String()
+}
+func (r rootFileInfo) Type() g.ObjectType {
+	return g.ObjectTree
 }
 
 type modTimeFileInfo struct {
 	os.FileInfo
+	mode    os.FileMode
 	modTime time.Time
 }
 
+func (m modTimeFileInfo) Size() int64 {
+	return entrySize(m.entry())
+}
+func (m modTimeFileInfo) Mode() os.FileMode {
+	return m.mode
+}
+func (m modTimeFileInfo) IsDir() bool {
+	return m.mode.IsDir()
+}
 func (m modTimeFileInfo) ModTime() time.Time {
 	return m.modTime
 }
+func (m modTimeFileInfo) Sys() interface{} {
+	// The embedded FileInfo is the *g.TreeEntry
+	return m.FileInfo
+}
+func (m modTimeFileInfo) entry() *g.TreeEntry {
+	return m.FileInfo.(*g.TreeEntry)
+}
+func (m modTimeFileInfo) SHA() string {
+	return m.entry().Id.String()
+}
+func (m modTimeFileInfo) Type() g.ObjectType {
+	return m.entry().Type
+}
+
+// Guards the size a *g.TreeEntry caches on the first call of Size. The
+// entries are shared by all lookups in the trees of a commit
+var sizeMu sync.Mutex
+
+// Size of the blob of entry, safe for concurrent use
+func entrySize(entry *g.TreeEntry) int64 {
+	sizeMu.Lock()
+	defer sizeMu.Unlock()
+	return entry.Size()
+}
+
+// Map the git mode of an entry to an os.FileMode
+func entryMode(entry *g.TreeEntry) os.FileMode {
+	switch entry.EntryMode() {
+	case g.ModeTree, g.ModeCommit:
+		return os.ModeDir | 0755
+	case g.ModeExec:
+		return 0755
+	case g.ModeBlob:
+		return 0644
+	case g.ModeSymlink:
+		return os.ModeSymlink | 0777
+	default:
+		return entry.Mode()
+	}
+}
 
 type ghfsFile struct {
-	entry *g.TreeEntry
-	fi    os.FileInfo
-	rc    io.ReadCloser
-	off   int64
-	atEnd bool
+	entry  *g.TreeEntry
+	fi     os.FileInfo
+	cache  *BlobCache
+	ctx    context.Context
+	tracer Tracer
+	limit  int64
+	sized  sync.Once
+	size   int64
+	// Guards data, as ReadAt may be called concurrently
+	mu     sync.Mutex
+	data   []byte
+	rc     io.ReadCloser
+	off    int64
+	atEnd  bool
+	endOff int64
 }
 
-// Implement http.File on a git blob
+// Implement http.File on a git blob. Symlinks are served like regular
+// files with the link target as content. Their FileInfo has
+// os.ModeSymlink set and the target can be read with Readlink
 func NewFile(entry *g.TreeEntry, fi os.FileInfo) (http.File, error) {
 	return &ghfsFile{entry: entry, fi: fi}, nil
 }
 
+// Implemented by files that are symlinks
+type Linker interface {
+	Readlink() (string, error)
+}
+
+// Return the target of a symlink
+func (f *ghfsFile) Readlink() (string, error) {
+	if f.entry.EntryMode() != g.ModeSymlink {
+		return "", &os.PathError{Op: "readlink", Path: f.entry.Name(), Err: os.ErrInvalid}
+	}
+	return linkTarget(f.entry)
+}
+func linkTarget(entry *g.TreeEntry) (string, error) {
+	rc, err := blobData(entry)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	target, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", errors.Wrap(err, "Cannot read link target.")
+	}
+	return string(target), nil
+}
+
+// Blobs up to this size are read into memory on first access, so seeking
+// is constant time. Larger blobs are streamed and seeking backwards
+// reads the blob from the start again. See WithSeekBufferLimit
+const seekBufferLimit = 4 << 20
+
+// Open the blob data. Reads fail once the context of the file is done
+func (f *ghfsFile) open() (io.ReadCloser, error) {
+	rc, err := f.traceData()
+	if err != nil || f.ctx == nil {
+		return rc, err
+	}
+	return ctxReader{f.ctx, rc}, nil
+}
+func (f *ghfsFile) traceData() (io.ReadCloser, error) {
+	if f.tracer == nil {
+		return f.cache.Data(f.entry)
+	}
+	_, span := startSpan(f.tracer, f.ctx, "ghfs.readBlob")
+	span.SetAttribute("ghfs.sha", f.entry.Id.String())
+	span.SetAttribute("ghfs.size", f.blobSize())
+	rc, err := f.cache.Data(f.entry)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	return &spanReader{ReadCloser: rc, span: span}, nil
+}
+
+type ctxReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r ctxReader) Read(buf []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(buf)
+}
+
+// Size of the blob. Only looked up once, without reading blob data
+func (f *ghfsFile) blobSize() int64 {
+	f.sized.Do(func() {
+		f.size = entrySize(f.entry)
+	})
+	return f.size
+}
+func (f *ghfsFile) buffered() bool {
+	limit := f.limit
+	if limit == 0 {
+		limit = seekBufferLimit
+	}
+	return f.blobSize() <= limit
+}
+
+// Read fills buf unless the end of the blob is reached, even if the
+// underlying reader returns short reads
 func (f *ghfsFile) Read(buf []byte) (int, error) {
-	var err error
-	if f.rc == nil {
-		f.rc, err = f.entry.Blob().Data()
-		if err != nil {
-			return 0, errors.Wrap(err, "Cannot get Data()")
+	if f.buffered() {
+		n, err := f.ReadAt(buf, f.off)
+		f.off += int64(n)
+		if n > 0 && err == io.EOF {
+			err = nil
 		}
+		return n, err
 	}
 
 	if f.atEnd {
 		return 0, io.EOF
 	}
 
-	n, err := f.rc.Read(buf)
+	var err error
+	if f.rc == nil {
+		f.rc, err = f.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := io.ReadFull(f.rc, buf)
 	f.off += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
 	return n, err
 }
 func (f *ghfsFile) Close() error {
+	f.mu.Lock()
+	f.data = nil
+	f.mu.Unlock()
+	return f.closeReader()
+}
+func (f *ghfsFile) closeReader() error {
 	var ret error
 	if f.rc != nil {
 		ret = f.rc.Close()
 		f.rc = nil
 	}
 	f.off = 0
+	f.atEnd = false
 	return ret
 }
+
+// Implement io.ReaderAt. Blobs up to the seek buffer limit are read into
+// memory on the first call, so further calls don't touch git. Larger blobs
+// are read from the start on every call. Calls may run in parallel
+func (f *ghfsFile) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("Invalid offset")
+	}
+	if !f.buffered() {
+		return f.streamAt(buf, off)
+	}
+	data, err := f.load()
+	if err != nil {
+		return 0, err
+	}
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(buf, data[off:])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read a streamed blob at off with a reader of its own, so the position of
+// Read is kept
+func (f *ghfsFile) streamAt(buf []byte, off int64) (int, error) {
+	if off >= f.blobSize() {
+		return 0, io.EOF
+	}
+	rc, err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	if _, err := copyBuffer(ioutil.Discard, io.LimitReader(rc, off)); err != nil {
+		return 0, errors.Wrap(err, "Cannot skip blob data.")
+	}
+	n, err := io.ReadFull(rc, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+func (f *ghfsFile) load() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data != nil {
+		return f.data, nil
+	}
+	// Share cached contents instead of copying them for every open file
+	if data, ok := f.cache.cached(f.entry); ok {
+		f.data = data
+		return data, nil
+	}
+	rc, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// Read into a buffer of the final size instead of growing one
+	data := make([]byte, f.blobSize())
+	n, err := io.ReadFull(rc, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, errors.Wrap(err, "Cannot read blob.")
+	}
+	f.data = data[:n]
+	return f.data, nil
+}
 func (f *ghfsFile) Readdir(count int) ([]os.FileInfo, error) {
-	return nil, os.ErrInvalid
+	return nil, &os.PathError{Op: "readdir", Path: f.entry.Name(), Err: ErrNotDir}
 }
 func (f *ghfsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.buffered() {
+		return f.seekBuffered(offset, whence)
+	}
+
 	var noff int64
 
-	if whence == io.SeekCurrent && f.atEnd {
-		whence = io.SeekEnd
+	pos := f.off
+	if f.atEnd {
+		pos = f.endOff
 	}
 
 	switch whence {
 	case io.SeekStart:
 		noff = offset
 	case io.SeekCurrent:
-		noff = f.off + offset
+		noff = pos + offset
 	case io.SeekEnd:
-		if offset == 0 {
-			f.atEnd = true
-			return f.entry.Size(), nil
-		}
-		noff = f.entry.Size() + offset
+		noff = f.blobSize() + offset
 	default:
 		return 0, errors.New("Invalid argument for whence")
 	}
 
+	if noff < 0 {
+		// Keep the position, like os.File
+		return 0, errors.New("Invalid offset")
+	}
+	if noff >= f.blobSize() {
+		// Like os.File, seeking to or past the end succeeds and reads
+		// return io.EOF. The reader isn't moved, f.off keeps its
+		// position
+		f.atEnd = true
+		f.endOff = noff
+		return noff, nil
+	}
 	f.atEnd = false
 
 	switch {
-	case noff < 0:
-		return 0, errors.New("Invalid offset")
 	case noff < f.off:
-		f.Close()
-		return io.CopyN(ioutil.Discard, f, noff)
+		f.closeReader()
+		return f.skip(noff)
 	case noff >= f.off:
-		_, err := io.CopyN(ioutil.Discard, f, noff-f.off)
+		_, err := f.skip(noff - f.off)
 		return f.off, err
 	default:
 		panic("Unreachable")
 	}
 }
+
+// Read and drop n bytes of a streamed blob
+func (f *ghfsFile) skip(n int64) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	var skipped int64
+	for skipped < n {
+		chunk := *buf
+		if rest := n - skipped; rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		m, err := f.Read(chunk)
+		skipped += int64(m)
+		if err == io.EOF && skipped < n {
+			return skipped, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+func (f *ghfsFile) seekBuffered(offset int64, whence int) (int64, error) {
+	var noff int64
+
+	switch whence {
+	case io.SeekStart:
+		noff = offset
+	case io.SeekCurrent:
+		noff = f.off + offset
+	case io.SeekEnd:
+		noff = f.blobSize() + offset
+	default:
+		return 0, errors.New("Invalid argument for whence")
+	}
+
+	if noff < 0 {
+		return 0, errors.New("Invalid offset")
+	}
+	f.off = noff
+	return noff, nil
+}
 func (f *ghfsFile) Stat() (os.FileInfo, error) {
 	return f.fi, nil
 }
 
-// Implement a http.Filesystem for a git Tree
+// Implement a http.Filesystem for a git Tree. commit is nil when serving
+// a tree without a commit
 type ghfs struct {
-	commit *g.Commit
-	tree   *g.Tree
+	commit  *g.Commit
+	tree    *g.Tree
+	modTime time.Time
+	cache   *BlobCache
+	maxSize int64
+	hidden  []string
+	allow   []string
+	deny    []string
+	fold    bool
+	follow  bool
+	blames  *blames
+	subtree *subtreePath
+	tracer  Tracer
+	index   *pathIndex
+	blobs   *blobIndex
+	limit   int64
+
+	modTimeOf func(fs ghfs, name string, entry *g.TreeEntry) time.Time
+	mapErr    func(error) error
+}
+
+// Configure a filesystem returned by FromCommit and the other From*
+// constructors
+type Option func(*ghfs)
+
+// Serve tree instead of the root tree of the commit. History operations
+// look up the path of tree in the commit once and fail with
+// ErrAmbiguousSubtree if the commit has several trees with its content
+func WithSubtree(tree *g.Tree) Option {
+	return func(fs *ghfs) {
+		fs.tree = tree
+	}
+}
+
+// Serve git tree from commit. All entries, including the root directory,
+// report the author time of the commit as ModTime, so Last-Modified and
+// If-Modified-Since are stable for the commit
+func FromCommit(commit *g.Commit, opts ...Option) http.FileSystem {
+	fs := ghfs{
+		commit:  commit,
+		tree:    &commit.Tree,
+		modTime: commit.Author.When,
+		blames:  &blames{lines: map[string]*blameLines{}},
+		subtree: &subtreePath{},
+		blobs:   &blobIndex{},
+	}
+	for _, opt := range opts {
+		opt(&fs)
+	}
+	return fs
 }
 
 // Serve git tree from commit. Optionally from subtree
-func FromCommit(commit *g.Commit, tree ...*g.Tree) http.FileSystem {
-	var t *g.Tree
+//
+// Deprecated: Use FromCommit with WithSubtree.
+func FromCommitTree(commit *g.Commit, tree ...*g.Tree) http.FileSystem {
 	if len(tree) == 0 {
-		t = &commit.Tree
-	} else {
-		t = tree[0]
+		return FromCommit(commit)
+	}
+	return FromCommit(commit, WithSubtree(tree[0]))
+}
+
+// Serve git tree without a commit. All entries report the zero time as
+// ModTime unless configured with WithModTime
+func FromTree(tree *g.Tree, opts ...Option) http.FileSystem {
+	fs := ghfs{tree: tree, blobs: &blobIndex{}}
+	for _, opt := range opts {
+		opt(&fs)
+	}
+	return fs
+}
+
+// Report modTime(entry) as ModTime of entries. modTime is called with nil
+// for the root directory. A constant modTime makes listings and archives
+// reproducible
+func WithModTime(modTime func(*g.TreeEntry) time.Time) Option {
+	return func(fs *ghfs) {
+		fs.modTimeOf = func(_ ghfs, _ string, entry *g.TreeEntry) time.Time {
+			return modTime(entry)
+		}
+	}
+}
+
+// Refuse to open blobs larger than n bytes with an *os.PathError wrapping
+// ErrFileTooLarge. The size is checked before any blob data is read and
+// the blobs are still listed and can be stat'ed. Handler responds with
+// 413 Request Entity Too Large
+func WithMaxFileSize(n int64) Option {
+	return func(fs *ghfs) {
+		fs.maxSize = n
+	}
+}
+
+// Hide files and directories whose name starts with one of prefixes, or
+// with "." if no prefixes are given. Hidden entries are not listed and
+// fail to open with os.ErrNotExist, as do paths below hidden directories.
+// .gitattributes files are still honored by Handler
+func WithHiddenPrefix(prefixes ...string) Option {
+	if len(prefixes) == 0 {
+		prefixes = []string{"."}
+	}
+	return func(fs *ghfs) {
+		fs.hidden = prefixes
+	}
+}
+
+// Only serve paths matching one of the glob patterns, and the directories
+// that may contain them. Patterns use the .gitattributes syntax: without a
+// slash they match the base name at any depth, so every directory is
+// served, otherwise the whole path, where ** matches any number of
+// directories. Everything below a matching directory is allowed as well.
+// Other paths are not listed and fail to open with os.ErrNotExist
+func WithAllow(patterns ...string) Option {
+	return func(fs *ghfs) {
+		fs.allow = append(fs.allow, patterns...)
+	}
+}
+
+// Don't serve paths matching one of the glob patterns, nor anything below
+// them. Patterns are matched like those of WithAllow, but take precedence
+func WithDeny(patterns ...string) Option {
+	return func(fs *ghfs) {
+		fs.deny = append(fs.deny, patterns...)
+	}
+}
+
+// Look up paths that don't exist case-insensitively, e.g. for links
+// written for a case-insensitive filesystem. Exact matches are preferred
+func WithCaseInsensitive() Option {
+	return func(fs *ghfs) {
+		fs.fold = true
+	}
+}
+
+// Resolve symlinks in paths and serve their targets instead of the link.
+// Targets that are absolute, escape the tree or need more than
+// maxSymlinkHops links to resolve don't exist
+func WithFollowSymlinks() Option {
+	return func(fs *ghfs) {
+		fs.follow = true
 	}
-	return ghfs{commit, t}
+}
+
+const maxSymlinkHops = 8
+
+// Read blobs of up to n bytes into memory on first access instead of the
+// default of 4 MiB, so they can be read at any offset and seeked in
+// constant time. Larger blobs are streamed, where seeking forward skips
+// data and seeking backwards opens the blob again. A negative n streams
+// all blobs
+func WithSeekBufferLimit(n int64) Option {
+	return func(fs *ghfs) {
+		fs.limit = n
+	}
+}
+
+// Pass errors returned by Open, Stat and ReadFile through mapErr
+func WithErrorMapper(mapErr func(error) error) Option {
+	return func(fs *ghfs) {
+		fs.mapErr = mapErr
+	}
+}
+
+var (
+	// Returned when a requested branch does not exist
+	ErrNoSuchBranch = errors.New("No such branch")
+	// Returned when a requested tag does not exist
+	ErrNoSuchTag = errors.New("No such tag")
+	// Returned when a ref is neither a branch, a tag nor a commit id
+	ErrNoSuchRef = errors.New("No such ref")
+	// Returned when HEAD points to a branch without commits
+	ErrUnbornHead = errors.New("HEAD points to an unborn branch")
+	// Returned when a tag or commit id refers to a tree or blob instead of
+	// a commit
+	ErrNotCommit = errors.New("Object is not a commit")
+	// Returned when opening a blob larger than the WithMaxFileSize limit
+	ErrFileTooLarge = errors.New("File too large")
+	// Returned when reading a directory like a file. Missing paths fail
+	// with os.ErrNotExist instead. Matches fs.ErrInvalid and
+	// syscall.EISDIR with errors.Is, which were returned before
+	ErrIsDir error = &compatError{"Is a directory", []error{fs.ErrInvalid, syscall.EISDIR}}
+	// Returned when listing a file like a directory. Matches fs.ErrInvalid
+	// and syscall.ENOTDIR with errors.Is, which were returned before
+	ErrNotDir error = &compatError{"Not a directory", []error{fs.ErrInvalid, syscall.ENOTDIR}}
+	// Returned by FromTime when the first commit is younger than the
+	// requested time
+	ErrNoCommitBefore = errors.New("No commit before time")
+)
+
+// An error that also matches the errors returned in its place before
+type compatError struct {
+	msg    string
+	compat []error
+}
+
+func (e *compatError) Error() string {
+	return e.msg
+}
+func (e *compatError) Is(target error) bool {
+	for _, err := range e.compat {
+		if target == err {
+			return true
+		}
+	}
+	return false
+}
+
+// Serve git tree of the commit a branch points to
+func FromBranch(repo *g.Repository, branchname string, opts ...Option) (http.FileSystem, error) {
+	if !repo.IsBranchExist(branchname) {
+		return nil, errors.Wrap(ErrNoSuchBranch, branchname)
+	}
+	commit, err := repo.GetCommitOfBranch(branchname)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot get commit of branch.")
+	}
+	return FromCommit(commit, opts...), nil
+}
+
+// Look up the tree entry of a path relative to the served tree and
+// return it with its path, which differs from name for case-insensitive
+// matches. Missing entries yield an *os.PathError wrapping os.ErrNotExist
+func (fs ghfs) lookup(name string) (string, *g.TreeEntry, error) {
+	if fs.follow {
+		var err error
+		if name, err = fs.resolveLinks(name); err != nil {
+			return "", nil, err
+		}
+	}
+
+	entry, err := fs.entryByPath(name)
+	if err == g.ErrNotExist && fs.fold {
+		var folded string
+		if folded, err = fs.foldPath(name); err == nil {
+			name = folded
+			entry, err = fs.entryByPath(name)
+		}
+	}
+	switch {
+	case err == g.ErrNotExist:
+		return "", nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case err != nil:
+		return "", nil, errors.Wrap(err, "Cannot get entry.")
+	}
+
+	if fs.excluded(name, entry) {
+		return "", nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return name, entry, nil
+}
+
+// Replace symlinks in name by their targets. Missing elements are left
+// to the lookup to report
+func (fs ghfs) resolveLinks(name string) (string, error) {
+	notExist := &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	elems := strings.Split(name, "/")
+	for i, hops := 0, 0; i < len(elems); i++ {
+		p := strings.Join(elems[:i+1], "/")
+		entry, err := fs.entryByPath(p)
+		if err != nil {
+			break
+		}
+		if entry.EntryMode() != g.ModeSymlink {
+			continue
+		}
+
+		if hops++; hops > maxSymlinkHops {
+			return "", notExist
+		}
+		target, err := linkTarget(entry)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			return "", notExist
+		}
+		target, ok := cleanPath(path.Join(path.Dir(p), target))
+		if !ok || target == "" {
+			// Links to the root can't be looked up as entries
+			return "", notExist
+		}
+
+		elems = append(strings.Split(target, "/"), elems[i+1:]...)
+		i = -1
+	}
+	return strings.Join(elems, "/"), nil
+}
+
+// Resolve name by matching every element case-insensitively. Exact
+// matches are preferred, otherwise the first match in tree order wins.
+// Returns g.ErrNotExist if an element has no match
+func (fs ghfs) foldPath(name string) (string, error) {
+	tree := fs.tree
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		entry, err := foldEntry(tree, elem)
+		if err != nil {
+			return "", err
+		}
+		elems[i] = entry.Name()
+		if i == len(elems)-1 {
+			break
+		}
+		if entry.Type != g.ObjectTree {
+			return "", g.ErrNotExist
+		}
+		if tree, err = tree.SubTree(entry.Name()); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(elems, "/"), nil
+}
+func foldEntry(tree *g.Tree, name string) (*g.TreeEntry, error) {
+	scanner, err := tree.Scanner()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open scanner.")
+	}
+	var match *g.TreeEntry
+	for scanner.Scan() {
+		entry := scanner.TreeEntry()
+		if entry.Name() == name {
+			return entry, nil
+		}
+		if match == nil && strings.EqualFold(entry.Name(), name) {
+			match = entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Cannot scan tree.")
+	}
+	if match == nil {
+		return nil, g.ErrNotExist
+	}
+	return match, nil
+}
+
+// FileInfo of the entry at name of the served tree
+func (fs ghfs) fileInfo(name string, entry *g.TreeEntry) os.FileInfo {
+	return modTimeFileInfo{FileInfo: entry, mode: entryMode(entry), modTime: fs.entryModTime(name, entry)}
+}
+
+// ModTime of the entry at name. entry is nil for the root directory
+func (fs ghfs) entryModTime(name string, entry *g.TreeEntry) time.Time {
+	if fs.modTimeOf == nil {
+		return fs.modTime
+	}
+	return fs.modTimeOf(fs, name, entry)
+}
+
+// Fail for blobs exceeding the WithMaxFileSize limit
+func (fs ghfs) checkSize(op, name string, entry *g.TreeEntry) error {
+	if fs.maxSize > 0 && entrySize(entry) > fs.maxSize {
+		return &os.PathError{Op: op, Path: name, Err: ErrFileTooLarge}
+	}
+	return nil
+}
+
+func (fs ghfs) isHidden(name string) bool {
+	for _, prefix := range fs.hidden {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether the entry at name is hidden or filtered by WithAllow and
+// WithDeny
+func (fs ghfs) excluded(name string, entry *g.TreeEntry) bool {
+	elems := strings.Split(name, "/")
+	for _, elem := range elems {
+		if fs.isHidden(elem) {
+			return true
+		}
+	}
+	if len(fs.allow) == 0 && len(fs.deny) == 0 {
+		return false
+	}
+
+	allowed := len(fs.allow) == 0
+	for i := range elems {
+		p := strings.Join(elems[:i+1], "/")
+		if matchAny(fs.deny, p) {
+			return true
+		}
+		allowed = allowed || matchAny(fs.allow, p)
+	}
+	if allowed {
+		return false
+	}
+	return entry.Type != g.ObjectTree || !leadsToMatch(fs.allow, elems)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchAttrPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether paths below the directory dir may match one of patterns
+func leadsToMatch(patterns []string, dir []string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			return true
+		}
+		if matchPrefix(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether name matches the leading segments of pattern, leaving at
+// least one segment to match below it
+func matchPrefix(pattern, name []string) bool {
+	for len(name) > 0 {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(pattern) > 0
+}
+
+// Return fs without hidden entries, looking through WithContext
+func unhide(fs http.FileSystem) http.FileSystem {
+	switch fs := fs.(type) {
+	case ghfs:
+		fs.hidden = nil
+		return fs
+	case ctxfs:
+		if cfs, ok := unhide(fs.fs).(ContextFileSystem); ok {
+			fs.fs = cfs
+		}
+		return fs
+	default:
+		return fs
+	}
+}
+
+func (fs ghfs) mapError(err error) error {
+	if err == nil || fs.mapErr == nil {
+		return err
+	}
+	return fs.mapErr(err)
+}
+
+// Open a directory of the served tree. Entries report the same FileInfo
+// as Open would
+func (fs ghfs) newDir(name string, tree *g.Tree, fi os.FileInfo) (http.File, error) {
+	f, err := NewDir(tree, fi)
+	if err != nil {
+		return nil, err
+	}
+	f.(*ghfsDir).info = func(entry *g.TreeEntry) os.FileInfo {
+		return fs.fileInfo(path.Join(name, entry.Name()), entry)
+	}
+	if len(fs.hidden) > 0 || len(fs.allow) > 0 || len(fs.deny) > 0 {
+		f.(*ghfsDir).hide = func(entry *g.TreeEntry) bool {
+			return fs.excluded(path.Join(name, entry.Name()), entry)
+		}
+	}
+	return f, nil
+}
+
+// Implemented by the filesystems serving a git tree, e.g. those returned
+// by FromCommit and FromTree
+type GitFileSystem interface {
+	http.FileSystem
+	// The commit of the served tree, nil if served without commit
+	Commit() *g.Commit
+	// The served tree, which is a subtree of the commit for WithSubtree
+	Tree() *g.Tree
+	// Open a blob of the served tree by its object id
+	OpenBlob(sha string) (http.File, error)
+	// Report the commit that last changed each line of a file
+	Blame(name string) ([]BlameLine, error)
+	// Return the commits that changed a file or directory
+	Log(name string, max int) ([]*g.Commit, error)
+	// Return the target of a symlink
+	Readlink(name string) (string, error)
+}
+
+func (fs ghfs) Commit() *g.Commit {
+	return fs.commit
+}
+func (fs ghfs) Tree() *g.Tree {
+	return fs.tree
+}
+
+// Return the target of the symlink at name, even with WithFollowSymlinks.
+// Fails with os.ErrInvalid if name isn't a symlink
+func (fs ghfs) Readlink(name string) (string, error) {
+	name, ok := cleanPath(name)
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrNotExist}
+	}
+	if name == "" {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+	}
+
+	if fs.follow {
+		// Links are only resolved in the parent directories
+		if dir := path.Dir(name); dir != "." {
+			dir, err := fs.resolveLinks(dir)
+			if err != nil {
+				return "", fs.mapError(err)
+			}
+			name = path.Join(dir, path.Base(name))
+		}
+		fs.follow = false
+	}
+
+	name, entry, err := fs.lookup(name)
+	if err != nil {
+		return "", fs.mapError(err)
+	}
+	if entry.EntryMode() != g.ModeSymlink {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+	}
+	return linkTarget(entry)
+}
+
+// Open the blob with object id sha. Only blobs of the served tree can
+// be opened. They are looked up in a map of all blobs, which is built by
+// walking the tree on the first call. Ids that aren't a blob of the tree
+// fail with os.ErrNotExist
+func (fs ghfs) OpenBlob(sha string) (http.File, error) {
+	name, entry, err := fs.blobs.get(fs, strings.ToLower(sha))
+	if err != nil {
+		return nil, fs.mapError(err)
+	}
+	if entry == nil {
+		return nil, fs.mapError(&os.PathError{Op: "open", Path: sha, Err: os.ErrNotExist})
+	}
+	if err := fs.checkSize("open", name, entry); err != nil {
+		return nil, fs.mapError(err)
+	}
+	return &ghfsFile{entry: entry, fi: fs.fileInfo(name, entry), cache: fs.cache, tracer: fs.tracer, limit: fs.limit}, nil
+}
+
+// Find the path and entry of the first blob with object id sha in tree,
+// depth first. The entry is nil if there is none
+func (fs ghfs) findBlob(tree *g.Tree, prefix, sha string) (string, *g.TreeEntry, error) {
+	scanner, err := tree.Scanner()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Cannot open scanner.")
+	}
+	for scanner.Scan() {
+		e := scanner.TreeEntry()
+		name := path.Join(prefix, e.Name())
+		if fs.excluded(name, e) {
+			continue
+		}
+		switch e.Type {
+		case g.ObjectBlob:
+			if e.Id.String() == sha {
+				return name, e, nil
+			}
+		case g.ObjectTree:
+			sub, err := tree.SubTree(e.Name())
+			if err != nil {
+				return "", nil, errors.Wrap(err, "Cannot get subtree.")
+			}
+			if name, entry, err := fs.findBlob(sub, name, sha); entry != nil || err != nil {
+				return name, entry, err
+			}
+		}
+	}
+	return "", nil, errors.Wrap(scanner.Err(), "Cannot scan tree.")
+}
+
+// Implemented by filesystems whose files stop reading when ctx is done
+type ContextFileSystem interface {
+	http.FileSystem
+	OpenContext(ctx context.Context, name string) (http.File, error)
+}
+
+// Like Open, but blob reads fail with ctx.Err() once ctx is done
+func (fs ghfs) OpenContext(ctx context.Context, name string) (http.File, error) {
+	f, err := fs.traceOpen(ctx, name)
+	if file, ok := f.(*ghfsFile); ok {
+		file.ctx = ctx
+	}
+	return f, err
 }
 
 func (fs ghfs) Open(name string) (http.File, error) {
+	return fs.traceOpen(context.Background(), name)
+}
+func (fs ghfs) traceOpen(ctx context.Context, name string) (http.File, error) {
+	ctx, span := startSpan(fs.tracer, ctx, "ghfs.Open")
+	span.SetAttribute("ghfs.path", name)
+	f, err := fs.open(ctx, name)
+	if err == nil {
+		if fi, ok := f.(*ghfsFile); ok {
+			span.SetAttribute("ghfs.sha", fi.entry.Id.String())
+			span.SetAttribute("ghfs.size", fi.blobSize())
+		}
+	}
+	span.End(err)
+
+	countOpenError(err)
+	return f, fs.mapError(err)
+}
+func (fs ghfs) open(ctx context.Context, name string) (http.File, error) {
 	var entry *g.TreeEntry
-	name = strings.TrimPrefix(name, "/")
+	// Like os.Open, a trailing slash only matches directories
+	dirOnly := strings.HasSuffix(name, "/")
+	name, ok := cleanPath(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
 	if name == "" {
-		return NewDir(fs.tree, rootFileInfo{})
+		return fs.newDir("", fs.tree, rootFileInfo{tree: fs.tree, modTime: fs.entryModTime("", nil)})
 	} else {
+		_, span := startSpan(fs.tracer, ctx, "ghfs.lookup")
+		span.SetAttribute("ghfs.path", name)
 		var err error
-		entry, err = fs.tree.GetTreeEntryByPath(name)
-		switch {
-		case err == g.ErrNotExist:
-			return nil, os.ErrNotExist
-		case err != nil:
-			return nil, errors.Wrap(err, "Cannot get entry.")
+		name, entry, err = fs.lookup(name)
+		span.End(err)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	fi := modTimeFileInfo{entry, fs.commit.Author.When}
+	fi := fs.fileInfo(name, entry)
 
 	switch entry.Type {
 	case g.ObjectTree:
 		stree, err := fs.tree.SubTree(name)
-		if err != nil {
-			return nil, err
+		switch {
+		case err == g.ErrNotExist:
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		case err != nil:
+			return nil, errors.Wrap(err, "Cannot get subtree.")
 		}
-		return NewDir(stree, fi)
+		return fs.newDir(name, stree, fi)
 	case g.ObjectBlob:
-		return NewFile(entry, fi)
+		if dirOnly {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		if err := fs.checkSize("open", name, entry); err != nil {
+			return nil, err
+		}
+		return &ghfsFile{entry: entry, fi: fi, cache: fs.cache, tracer: fs.tracer, limit: fs.limit}, nil
+	case g.ObjectCommit:
+		// Submodules are not part of the repository, serve them as
+		// empty directories
+		return &ghfsDir{fi: fi, entries: []*g.TreeEntry{}}, nil
 	default:
 		return nil, errors.New("Invalid type")
 	}
 }
+
+// Serve git tree of the commit a tag points to. Annotated tags are
+// dereferenced to their commit, also through tags of tags. Tags of trees
+// and blobs return ErrNotCommit
+func FromTag(repo *g.Repository, tagname string, opts ...Option) (http.FileSystem, error) {
+	if !repo.IsTagExist(tagname) {
+		return nil, errors.Wrap(ErrNoSuchTag, tagname)
+	}
+	tag, err := repo.GetTag(tagname)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot get tag.")
+	}
+
+	typ, id := g.ObjectType(tag.Type), tag.Object.String()
+	for typ == g.ObjectTag {
+		if typ, id, err = peelTag(repo, id); err != nil {
+			return nil, errors.Wrapf(err, "Cannot dereference tag %s.", tagname)
+		}
+	}
+	if typ != g.ObjectCommit {
+		return nil, errors.Wrapf(ErrNotCommit, "Tag %s points to a %s", tagname, typ)
+	}
+
+	commit, err := repo.GetCommit(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot get commit of tag.")
+	}
+	return FromCommit(commit, opts...), nil
+}
+
+// Serve git tree of the commit with the given id. The id may be
+// abbreviated as long as no other commit starts with it. Ids of trees and
+// blobs return ErrNotCommit
+func FromHash(repo *g.Repository, id string, opts ...Option) (http.FileSystem, error) {
+	full, err := expandId(repo, id)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.GetCommit(full)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot get commit.")
+	}
+	return FromCommit(commit, opts...), nil
+}
+
+// Serve git tree of a ref. Like git checkout, the ref is resolved as a
+// branch first, then as a tag and finally as a possibly abbreviated
+// commit id. ErrNoSuchRef is returned if none of them match. Revisions
+// like master@{3} are served with FromReflog
+func FromRef(repo *g.Repository, ref string, opts ...Option) (http.FileSystem, error) {
+	if name, n, ok := parseReflogRef(ref); ok {
+		return FromReflog(repo, name, n, opts...)
+	}
+
+	switch {
+	case repo.IsBranchExist(ref):
+		return FromBranch(repo, ref, opts...)
+	case repo.IsTagExist(ref):
+		return FromTag(repo, ref, opts...)
+	}
+
+	fs, err := FromHash(repo, ref, opts...)
+	switch errors.Cause(err) {
+	case nil:
+		return fs, nil
+	case ErrInvalidId, ErrNoSuchObject, g.ErrNotExist:
+		return nil, errors.Wrap(ErrNoSuchRef, ref)
+	default:
+		return nil, err
+	}
+}
+
+// Serve git tree of the latest commit of ref whose committer time is not
+// after t. ref is resolved like FromRef and its history followed along
+// first parents
+func FromTime(repo *g.Repository, ref string, t time.Time, opts ...Option) (http.FileSystem, error) {
+	fs, err := FromRef(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := commitBefore(fs.(GitFileSystem).Commit(), t)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s at %s", ref, t.Format(time.RFC3339))
+	}
+	return FromCommit(commit, opts...), nil
+}
+
+// Follow the first parents of commit to the first one committed at or
+// before t
+func commitBefore(commit *g.Commit, t time.Time) (*g.Commit, error) {
+	for commit.Committer.When.After(t) {
+		if commit.ParentCount() == 0 {
+			return nil, ErrNoCommitBefore
+		}
+		var err error
+		if commit, err = commit.Parent(0); err != nil {
+			return nil, errors.Wrap(err, "Cannot get parent commit.")
+		}
+	}
+	return commit, nil
+}
+
+// Serve git tree of the commit HEAD points to. HEAD may be detached
+func FromRepo(repo *g.Repository, opts ...Option) (http.FileSystem, error) {
+	head, err := ioutil.ReadFile(filepath.Join(gitDir(repo), "HEAD"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot read HEAD.")
+	}
+
+	ref := strings.TrimSpace(string(head))
+	if !strings.HasPrefix(ref, "ref: ") {
+		commit, err := repo.GetCommit(ref)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot get commit of detached HEAD.")
+		}
+		return FromCommit(commit, opts...), nil
+	}
+
+	branchname := strings.TrimPrefix(strings.TrimPrefix(ref, "ref: "), "refs/heads/")
+	if !repo.IsBranchExist(branchname) {
+		return nil, errors.Wrap(ErrUnbornHead, branchname)
+	}
+	return FromBranch(repo, branchname, opts...)
+}
@@ -0,0 +1,691 @@
+package ghfs
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+func TestDirErrors(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"d/a": "a"})
+	hfs := FromCommit(commit)
+	fsys := FS(hfs)
+
+	d, err := hfs.Open("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	_, readErr := d.Read(make([]byte, 1))
+	_, readFileErr := fs.ReadFile(fsys, "d")
+	_, readDirErr := fs.ReadDir(fsys, "d/a")
+
+	tests := []struct {
+		name  string
+		err   error
+		is    []error
+		isNot []error
+	}{
+		{"Read of directory", readErr, []error{ErrIsDir, fs.ErrInvalid, syscall.EISDIR}, []error{ErrNotDir, syscall.ENOTDIR}},
+		{"ReadFile of directory", readFileErr, []error{ErrIsDir, fs.ErrInvalid, syscall.EISDIR}, []error{ErrNotDir, syscall.ENOTDIR}},
+		{"ReadDir of file", readDirErr, []error{ErrNotDir, fs.ErrInvalid, syscall.ENOTDIR}, []error{ErrIsDir, syscall.EISDIR}},
+	}
+	for _, test := range tests {
+		if test.err == nil {
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		for _, target := range test.is {
+			if !errors.Is(test.err, target) {
+				t.Errorf("%s: %v does not match %v", test.name, test.err, target)
+			}
+		}
+		for _, target := range test.isNot {
+			if errors.Is(test.err, target) {
+				t.Errorf("%s: %v matches %v", test.name, test.err, target)
+			}
+		}
+	}
+}
+
+// Return the sorted names of the entries of the directory name
+func readdirnames(t *testing.T, hfs http.FileSystem, name string) []string {
+	t.Helper()
+	f, err := hfs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestAllowDeny(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{
+		"public/a.html": "a", "public/secret/k": "k", "public/x.key": "x",
+		"src/main.go": "m", "docs/r.md": "r", "docs/sub/s.md": "s", "top.md": "t",
+	})
+	hfs := FromCommit(commit, WithAllow("public/**", "*.md"), WithDeny("*.key", "public/secret"))
+
+	for name, want := range map[string]bool{
+		"/public":          true,
+		"/public/a.html":   true,
+		"/public/x.key":    false,
+		"/public/secret":   false,
+		"/public/secret/k": false,
+		"/src":             true,
+		"/src/main.go":     false,
+		"/docs":            true,
+		"/docs/r.md":       true,
+		"/docs/sub/s.md":   true,
+		"/top.md":          true,
+	} {
+		f, err := hfs.Open(name)
+		if (err == nil) != want {
+			t.Errorf("Open(%q): got %v, want success %v", name, err, want)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			t.Errorf("Open(%q): got %v, want os.ErrNotExist", name, err)
+		}
+		if f != nil {
+			f.Close()
+		}
+	}
+
+	if got, want := readdirnames(t, hfs, "/"), []string{"docs", "public", "src", "top.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listing of /: got %q, want %q", got, want)
+	}
+	if got, want := readdirnames(t, hfs, "/public"), []string{"a.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listing of /public: got %q, want %q", got, want)
+	}
+}
+
+func TestFromTag(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"a": "a"})
+	f.git("tag", "light")
+	f.git("tag", "-a", "-m", "Annotated", "annotated")
+	f.git("tag", "-a", "-m", "Tag of a tag", "nested", "annotated")
+	f.git("tag", "-a", "-m", "Tag of a tag of a tag", "nested2", "nested")
+	f.git("tag", "-a", "-m", "Tag of a tree", "tree", "HEAD^{tree}")
+	f.git("tag", "-a", "-m", "Tag of a blob", "blob", "HEAD:a")
+	f.git("tag", "-a", "-m", "Tag of a tag of a blob", "nestedblob", "blob")
+
+	test := func(t *testing.T) {
+		repo := f.repo()
+		for _, name := range []string{"light", "annotated", "nested", "nested2"} {
+			hfs, err := FromTag(repo, name)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			if id := hfs.(GitFileSystem).Commit().Id.String(); id != commit.Id.String() {
+				t.Errorf("%s: got commit %s, want %s", name, id, commit.Id)
+			}
+		}
+		for _, name := range []string{"tree", "blob", "nestedblob"} {
+			if _, err := FromTag(repo, name); errors.Cause(err) != ErrNotCommit {
+				t.Errorf("%s: got %v, want %v", name, err, ErrNotCommit)
+			}
+		}
+		if _, err := FromTag(repo, "nope"); errors.Cause(err) != ErrNoSuchTag {
+			t.Errorf("missing tag: got %v, want %v", err, ErrNoSuchTag)
+		}
+	}
+	t.Run("loose", test)
+	f.git("gc", "-q")
+	t.Run("packed", test)
+}
+
+func TestFromRef(t *testing.T) {
+	f, first := newRepo(t, map[string]string{"a": "1"})
+	c1 := first.Id.String()
+	f.git("tag", "light")
+	f.git("tag", "-a", "-m", "Annotated", "annotated")
+	f.git("tag", "same")
+	f.write("a", "2")
+	c2 := f.commit("Second").Id.String()
+	f.git("branch", "same")
+	repo := f.repo()
+
+	for _, test := range []struct {
+		ref, want string
+	}{
+		{"master", c2},
+		{"light", c1},
+		{"annotated", c1},
+		{c1, c1},
+		{c1[:7], c1},
+		{strings.ToUpper(c1[:7]), c1},
+		// Like git checkout, the branch wins over the tag
+		{"same", c2},
+	} {
+		hfs, err := FromRef(repo, test.ref)
+		if err != nil {
+			t.Errorf("%s: %v", test.ref, err)
+			continue
+		}
+		if id := hfs.(GitFileSystem).Commit().Id.String(); id != test.want {
+			t.Errorf("%s: got commit %s, want %s", test.ref, id, test.want)
+		}
+	}
+	for _, ref := range []string{"nope", "0000000", c1[:3]} {
+		if _, err := FromRef(repo, ref); errors.Cause(err) != ErrNoSuchRef {
+			t.Errorf("%s: got %v, want %v", ref, err, ErrNoSuchRef)
+		}
+	}
+}
+
+func TestFromTime(t *testing.T) {
+	f, first := newRepo(t, map[string]string{"a": "0", "b": "b"})
+	f.git("tag", "v0")
+	f.write("a", "1")
+	second := f.commit("Second")
+	f.write("a", "2")
+	third := f.commit("Third")
+	repo := f.repo()
+
+	hour := func(n int) time.Time {
+		return fixtureTime.Add(time.Duration(n) * time.Hour)
+	}
+	for _, test := range []struct {
+		ref  string
+		t    time.Time
+		want *g.Commit
+	}{
+		{"master", hour(0), first},
+		{"master", hour(1), second},
+		{"master", hour(1).Add(30 * time.Minute), second},
+		{"master", hour(5), third},
+		{"master", hour(2).In(time.FixedZone("", 3600)), third},
+		{"v0", hour(5), first},
+		{third.Id.String()[:7], hour(1), second},
+	} {
+		hfs, err := FromTime(repo, test.ref, test.t)
+		if err != nil {
+			t.Errorf("%s at %v: %v", test.ref, test.t, err)
+			continue
+		}
+		if id := hfs.(GitFileSystem).Commit().Id; id != test.want.Id {
+			t.Errorf("%s at %v: got commit %s, want %s", test.ref, test.t, id, test.want.Id)
+		}
+	}
+
+	if _, err := FromTime(repo, "master", hour(0).Add(-time.Second)); errors.Cause(err) != ErrNoCommitBefore {
+		t.Errorf("before the first commit: got %v, want %v", err, ErrNoCommitBefore)
+	}
+	if _, err := FromTime(repo, "nope", hour(5)); errors.Cause(err) != ErrNoSuchRef {
+		t.Errorf("missing ref: got %v, want %v", err, ErrNoSuchRef)
+	}
+
+	// Options apply to the found commit
+	hfs, err := FromTime(repo, "master", hour(1), WithDeny("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := readdirnames(t, hfs, "/"); !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("Readdir of / with WithDeny = %q, want [a]", names)
+	}
+}
+
+func TestOpenBlob(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"a": "1", "d/b": "22", "d/c": "1", "secret/k": "333"})
+	hfs := FromCommit(commit, WithHiddenPrefix("sec")).(GitFileSystem)
+
+	for name, want := range map[string]string{"a": "1", "d/b": "22"} {
+		sha := f.git("rev-parse", "HEAD:"+name)
+		for _, sha := range []string{sha, strings.ToUpper(sha)} {
+			file, err := hfs.OpenBlob(sha)
+			if err != nil {
+				t.Errorf("OpenBlob(%s) of %s: %v", sha, name, err)
+				continue
+			}
+			b, err := io.ReadAll(file)
+			file.Close()
+			if err != nil || string(b) != want {
+				t.Errorf("OpenBlob(%s) of %s: read %q, %v, want %q", sha, name, b, err, want)
+			}
+			// a and d/c have the same blob, the first depth first wins
+			if fi, err := file.Stat(); err != nil || fi.Name() != path.Base(name) {
+				t.Errorf("OpenBlob(%s) of %s: got name %v, %v", sha, name, fi.Name(), err)
+			}
+		}
+	}
+
+	for _, sha := range []string{
+		f.git("rev-parse", "HEAD:secret/k"),
+		f.git("rev-parse", "HEAD:d"),
+		strings.Repeat("0", fullIdLen),
+		"00",
+	} {
+		if _, err := hfs.OpenBlob(sha); !os.IsNotExist(err) {
+			t.Errorf("OpenBlob(%s): got %v, want os.ErrNotExist", sha, err)
+		}
+	}
+}
+
+func TestSubmodule(t *testing.T) {
+	f, first := newRepo(t, map[string]string{"a.txt": "a"})
+	f.gitlink("vendor/lib", first.Id.String())
+	hfs := FromCommit(f.commit("Add submodule"))
+
+	if names := readdirnames(t, hfs, "/vendor"); !reflect.DeepEqual(names, []string{"lib"}) {
+		t.Errorf("Readdir of /vendor = %v, want [lib]", names)
+	}
+	d, err := hfs.Open("/vendor/lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	fi, err := d.Stat()
+	if err != nil || !fi.IsDir() {
+		t.Errorf("Stat of submodule = %v, %v, want a directory", fi, err)
+	}
+	if fis, err := d.Readdir(-1); err != nil || len(fis) != 0 {
+		t.Errorf("Readdir of submodule = %v, %v, want no entries", fis, err)
+	}
+
+	w := httptest.NewRecorder()
+	Handler(hfs).ServeHTTP(w, httptest.NewRequest("GET", "/vendor/lib/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /vendor/lib/ = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestEmptyTree(t *testing.T) {
+	commit := newFixture(t).commit("Empty")
+	d, err := NewDir(&commit.Tree, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fis, err := d.Readdir(-1)
+	if err != nil || fis == nil || len(fis) != 0 {
+		t.Errorf("Readdir(-1) = %#v, %v, want [], nil", fis, err)
+	}
+
+	if names := readdirnames(t, FromCommit(commit), "/"); len(names) != 0 {
+		t.Errorf("Readdir of / = %v, want no entries", names)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a.txt": "a", "docs/b.txt": "b", "docs/c/d.txt": "d"})
+	docs, err := commit.Tree.SubTree("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subtrees := []struct {
+		name string
+		hfs  http.FileSystem
+		want []string
+	}{
+		{"FromCommit", FromCommit(commit), []string{"a.txt", "docs"}},
+		{"FromCommitTree without tree", FromCommitTree(commit), []string{"a.txt", "docs"}},
+		{"WithSubtree", FromCommit(commit, WithSubtree(docs)), []string{"b.txt", "c"}},
+		{"FromCommitTree", FromCommitTree(commit, docs), []string{"b.txt", "c"}},
+	}
+	for _, test := range subtrees {
+		if names := readdirnames(t, test.hfs, "/"); !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%s: Readdir of / = %v, want %v", test.name, names, test.want)
+		}
+	}
+
+	modTime := fixtureTime.Add(-24 * time.Hour)
+	hfs := FromCommit(commit, WithModTime(func(*g.TreeEntry) time.Time { return modTime }))
+	for _, name := range []string{"/", "/a.txt", "/docs/c"} {
+		fi, ok := stat(hfs, name)
+		if !ok {
+			t.Fatalf("Cannot stat %s", name)
+		}
+		if !fi.ModTime().Equal(modTime) {
+			t.Errorf("WithModTime: ModTime of %s = %v, want %v", name, fi.ModTime(), modTime)
+		}
+	}
+
+	errMapped := errors.New("Mapped")
+	hfs = FromCommit(commit, WithErrorMapper(func(err error) error {
+		if os.IsNotExist(err) {
+			return errMapped
+		}
+		return err
+	}))
+	if _, err := hfs.Open("/nope"); err != errMapped {
+		t.Errorf("WithErrorMapper: Open of a missing file = %v, want %v", err, errMapped)
+	}
+	if f, err := hfs.Open("/a.txt"); err != nil {
+		t.Errorf("WithErrorMapper: Open of an existing file = %v", err)
+	} else {
+		f.Close()
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"small.txt": "1234", "big.txt": "12345"})
+	hfs := FromCommit(commit, WithMaxFileSize(4))
+	reads := countBlobReads(t)
+
+	if f, err := hfs.Open("/small.txt"); err != nil {
+		t.Errorf("Open of a blob at the limit = %v", err)
+	} else {
+		f.Close()
+	}
+
+	isTooLarge := func(op string, err error) {
+		t.Helper()
+		var pe *os.PathError
+		if !errors.As(err, &pe) || pe.Op != op || !errors.Is(err, ErrFileTooLarge) {
+			t.Errorf("got %v, want %s error wrapping %v", err, op, ErrFileTooLarge)
+		}
+	}
+	_, err := hfs.Open("/big.txt")
+	isTooLarge("open", err)
+	_, err = hfs.(GitFileSystem).OpenBlob(f.git("rev-parse", "HEAD:big.txt"))
+	isTooLarge("open", err)
+	_, err = fs.ReadFile(FS(hfs), "big.txt")
+	isTooLarge("readfile", err)
+	if n := reads.Load(); n != 0 {
+		t.Errorf("%d blob reads for blobs above the limit", n)
+	}
+
+	// Still listed with their size
+	d, err := hfs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 2 || fis[0].Name() != "big.txt" || fis[0].Size() != 5 {
+		t.Errorf("Readdir of / = %v, want big.txt with size 5 first", fis)
+	}
+
+	h := Handler(hfs)
+	for _, method := range []string{"GET", "HEAD"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/big.txt", nil))
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s /big.txt = %d, want %d", method, w.Code, http.StatusRequestEntityTooLarge)
+		}
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/small.txt", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s /small.txt = %d, want %d", method, w.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	// In tree order: Docs, README.md, docs, readme.md
+	_, commit := newRepo(t, map[string]string{
+		"README.md":      "upper",
+		"readme.md":      "lower",
+		"Docs/Guide.txt": "guide",
+		"docs/other.txt": "other",
+	})
+	hfs := FromCommit(commit, WithCaseInsensitive())
+
+	for _, test := range []struct {
+		name    string
+		content string
+	}{
+		{"/README.md", "upper"},
+		{"/readme.md", "lower"},
+		// Without exact match, the first in tree order wins
+		{"/Readme.md", "upper"},
+		{"/README.MD", "upper"},
+		{"/DOCS/guide.txt", "guide"},
+		// Exact matches are preferred for every element, even if the
+		// path only exists in another case
+		{"/docs/Guide.txt", ""},
+		{"/DOCS/other.txt", ""},
+		{"/nope.md", ""},
+	} {
+		f, err := hfs.Open(test.name)
+		if test.content == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("Open of %s = %v, want not exist", test.name, err)
+			}
+			if err == nil {
+				f.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Open of %s = %v", test.name, err)
+			continue
+		}
+		if data, err := io.ReadAll(f); err != nil || string(data) != test.content {
+			t.Errorf("content of %s = %q, %v, want %q", test.name, data, err, test.content)
+		}
+		f.Close()
+	}
+
+	if fi, ok := stat(hfs, "/docs/GUIDE.TXT"); ok {
+		t.Errorf("Stat of /docs/GUIDE.TXT = %s, want not exist", fi.Name())
+	}
+	if fi, ok := stat(hfs, "/DOCS/GUIDE.TXT"); !ok || fi.Name() != "Guide.txt" {
+		t.Errorf("Stat of /DOCS/GUIDE.TXT = %v, want Guide.txt", fi)
+	}
+	if names := readdirnames(t, hfs, "/DOCS"); !reflect.DeepEqual(names, []string{"Guide.txt"}) {
+		t.Errorf("Readdir of /DOCS = %v, want [Guide.txt]", names)
+	}
+
+	if _, ok := stat(FromCommit(commit), "/Readme.md"); ok {
+		t.Error("/Readme.md exists without WithCaseInsensitive")
+	}
+}
+
+func TestBareRepository(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"a.txt": "a", "dir/b.txt": "b"})
+	f.git("tag", "-a", "-m", "Annotated", "v1")
+	f.git("gc", "-q")
+	repo := f.bare()
+	id := commit.Id.String()
+
+	for _, test := range []struct {
+		name string
+		open func() (http.FileSystem, error)
+	}{
+		{"FromRepo", func() (http.FileSystem, error) { return FromRepo(repo) }},
+		{"FromBranch", func() (http.FileSystem, error) { return FromBranch(repo, "master") }},
+		{"FromTag", func() (http.FileSystem, error) { return FromTag(repo, "v1") }},
+		{"FromHash", func() (http.FileSystem, error) { return FromHash(repo, id[:7]) }},
+	} {
+		hfs, err := test.open()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := hfs.(GitFileSystem).Commit().Id.String(); got != id {
+			t.Errorf("%s: got commit %s, want %s", test.name, got, id)
+		}
+		data, err := fs.ReadFile(FS(hfs), "dir/b.txt")
+		if err != nil || string(data) != "b" {
+			t.Errorf("%s: ReadFile = %q, %v", test.name, data, err)
+		}
+	}
+}
+
+func TestFromWorkTree(t *testing.T) {
+	f, _ := newRepo(t, map[string]string{"a.txt": "a"})
+	f.write("a.txt", "changed")
+	f.write("new.txt", "new")
+	// Would be the .git directory on a case-insensitive filesystem
+	f.write(".GIT/HEAD", "ref: refs/heads/master")
+	linked := filepath.Join(t.TempDir(), "linked")
+	f.git("worktree", "add", "-q", linked)
+	if err := os.WriteFile(filepath.Join(linked, "a.txt"), []byte("linked"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	linkedRepo, err := g.OpenRepository(linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		repo  *g.Repository
+		files map[string]string
+	}{
+		{"main", f.repo(), map[string]string{"a.txt": "changed", "new.txt": "new"}},
+		// .git is a file with the gitdir of the linked worktree
+		{"linked", linkedRepo, map[string]string{"a.txt": "linked"}},
+	} {
+		hfs, err := FromWorkTree(test.repo)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for name, want := range test.files {
+			data, err := fs.ReadFile(FS(hfs), name)
+			if err != nil || string(data) != want {
+				t.Errorf("%s: ReadFile(%s) = %q, %v, want %q", test.name, name, data, err, want)
+			}
+		}
+		for _, name := range []string{"/.git", "/.git/HEAD", "/.GIT", "/.Git/HEAD", ".git/"} {
+			if f, err := hfs.Open(name); !os.IsNotExist(err) {
+				t.Errorf("%s: Open(%q) = %v, want not exist", test.name, name, err)
+				if f != nil {
+					f.Close()
+				}
+			}
+		}
+		want := []string{}
+		for name := range test.files {
+			want = append(want, name)
+		}
+		sort.Strings(want)
+		if names := readdirnames(t, hfs, "/"); !reflect.DeepEqual(names, want) {
+			t.Errorf("%s: Readdir of / = %q, want %q", test.name, names, want)
+		}
+	}
+
+	gitDir, err := g.OpenRepository(filepath.Join(f.dir, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, repo := range map[string]*g.Repository{"bare": f.bare(), ".git": gitDir} {
+		if _, err := FromWorkTree(repo); errors.Cause(err) != ErrBareRepository {
+			t.Errorf("%s: got %v, want %v", name, err, ErrBareRepository)
+		}
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"foo.txt": "1", "foo/b": "2", "top/foo.txt": "1", "top/foo/b": "2", "docs/index.txt": "3"})
+	hfs := FromCommit(commit)
+	root, err := Sub(hfs, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := Sub(hfs, "top/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keepAll := func(string, os.FileInfo) bool { return true }
+
+	filesystems := []struct {
+		name string
+		hfs  http.FileSystem
+	}{
+		{"Open", hfs},
+		{"Sub of /", root},
+		{"Sub of top/", top},
+		{"filterfs", filterfs{fs: hfs, keep: keepAll}},
+		{"filterfs of Sub", filterfs{fs: top, keep: keepAll}},
+	}
+	names := []struct {
+		name  string
+		isDir bool
+		found bool
+	}{
+		{"/", true, true},
+		{"", true, true},
+		{"//", true, true},
+		{"/foo", true, true},
+		{"/foo/", true, true},
+		{"foo/", true, true},
+		{"/foo.txt", false, true},
+		{"foo.txt", false, true},
+		{"/foo.txt/", false, false},
+		{"foo.txt/", false, false},
+		{"/foo/b/", false, false},
+		{"/foo/b", false, true},
+	}
+	for _, fs := range filesystems {
+		for _, test := range names {
+			f, err := fs.hfs.Open(test.name)
+			if !test.found {
+				if !os.IsNotExist(err) {
+					t.Errorf("%s: Open(%q) = %v, want not exist", fs.name, test.name, err)
+				}
+				if f != nil {
+					f.Close()
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: Open(%q) = %v", fs.name, test.name, err)
+				continue
+			}
+			fi, err := f.Stat()
+			f.Close()
+			if err != nil || fi.IsDir() != test.isDir {
+				t.Errorf("%s: Stat of %q = %v, %v, want directory %v", fs.name, test.name, fi, err, test.isDir)
+			}
+		}
+	}
+
+	// Handler redirects to the path without slash
+	for _, p := range []string{"/foo.txt/", "/top/foo.txt/"} {
+		w := httptest.NewRecorder()
+		Handler(hfs).ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if loc := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || loc != "../foo.txt" {
+			t.Errorf("GET %s = %d to %q, want %d to ../foo.txt", p, w.Code, loc, http.StatusMovedPermanently)
+		}
+	}
+
+	// Directories without slash are redirected to the path with slash
+	handlers := []struct {
+		name string
+		h    http.Handler
+	}{
+		{"FileServer", http.FileServer(hfs)},
+		{"Handler", Handler(hfs)},
+	}
+	for _, h := range handlers {
+		for _, p := range []string{"/docs", "/top/foo"} {
+			req := httptest.NewRequest("GET", p, nil)
+			w := httptest.NewRecorder()
+			h.h.ServeHTTP(w, req)
+			loc, err := req.URL.Parse(w.Header().Get("Location"))
+			if err != nil || w.Code != http.StatusMovedPermanently || loc.Path != p+"/" {
+				t.Errorf("%s: GET %s = %d to %q, want %d to %s/", h.name, p, w.Code, w.Header().Get("Location"), http.StatusMovedPermanently, p)
+			}
+		}
+	}
+}
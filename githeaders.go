@@ -0,0 +1,27 @@
+package ghfs
+
+import (
+	"net/http"
+)
+
+// Set X-Git-Commit to the commit of fs if it is a GitFileSystem, X-Git-Ref
+// to ref unless it is empty and X-Git-Blob to the object id of served
+// blobs, e.g. to see which commit a cache served
+func WithGitHeaders(ref string) HandlerOption {
+	return func(h *handler) {
+		h.gitHeaders = true
+		h.ref = ref
+	}
+}
+
+func (h *handler) setGitHeaders(w http.ResponseWriter) {
+	if !h.gitHeaders {
+		return
+	}
+	if gfs, ok := h.fs.(GitFileSystem); ok && gfs.Commit() != nil {
+		w.Header().Set("X-Git-Commit", gfs.Commit().Id.String())
+	}
+	if h.ref != "" {
+		w.Header().Set("X-Git-Ref", h.ref)
+	}
+}
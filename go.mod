@@ -0,0 +1,12 @@
+module github.com/lemmi/ghfs
+
+go 1.26.0
+
+require (
+	github.com/pkg/errors v0.9.1
+	github.com/spf13/afero v1.15.0
+	golang.org/x/crypto v0.57.0
+	golang.org/x/net v0.59.0
+)
+
+require golang.org/x/text v0.42.0 // indirect
@@ -0,0 +1,331 @@
+package ghfs
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+type handler struct {
+	fs            http.FileSystem
+	attrs         *attributes
+	indexes       []string
+	noListings    bool
+	json          bool
+	precompressed bool
+	gitHeaders    bool
+	ref           string
+	notFound      string
+	fallback      string
+	cacheRules    []cacheRule
+	maxEntries    int
+}
+
+// Configure a Handler
+type HandlerOption func(*handler)
+
+// Serve fs like http.FileServer. Blobs get their object id as strong
+// ETag, so If-None-Match is answered with 304 Not Modified. Like
+// http.FileServer, directories requested without trailing slash are
+// redirected to the path with slash, so relative links of listings and
+// index files resolve. HEAD requests never read blob data. Their
+// Content-Type comes from .gitattributes or the extension and is omitted
+// if only sniffing the content could tell. If fs is a ContextFileSystem,
+// reads are cancelled with the request
+func Handler(fs http.FileSystem, opts ...HandlerOption) http.Handler {
+	h := &handler{fs: fs}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Serve the first of names that exists for directory requests instead of
+// a listing. Without this option, http.FileServer serves index.html
+func WithIndexFiles(names ...string) HandlerOption {
+	return func(h *handler) {
+		h.indexes = names
+	}
+}
+
+// Respond with 404 Not Found to requests for directories without an
+// index file instead of listing them
+func WithoutListings() HandlerOption {
+	return func(h *handler) {
+		h.noListings = true
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() { countRequest(time.Since(start)) }()
+	w = countingWriter{w}
+	h.setGitHeaders(w)
+	if r.Method == http.MethodHead && r.Header.Get("Range") != "" {
+		// Range is only defined for GET. Seeking to the range would read
+		// streamed blobs up to its start
+		r = r.Clone(r.Context())
+		r.Header.Del("Range")
+	}
+
+	fs := WithContext(r.Context(), h.fs)
+	name := path.Clean("/" + r.URL.Path)
+
+	fi, err := statErr(fs, name)
+	if tooLarge(err) {
+		httpError(w, err)
+		return
+	}
+	if os.IsNotExist(err) && (h.notFound != "" || h.fallback != "") {
+		h.serveNotFound(w, r, fs)
+		return
+	}
+	if err == nil && fi.IsDir() {
+		if h.serveIndex(w, r, fs, name) {
+			return
+		}
+		if h.noListings {
+			h.serveNotFound(w, r, fs)
+			return
+		}
+		if h.maxEntries > 0 {
+			fs = limitfs{fs, h.maxEntries, w.Header()}
+		}
+		if h.json && wantsJSON(r) {
+			serveJSONListing(w, fs, name)
+			return
+		}
+	}
+
+	if h.precompressed && err == nil && !fi.IsDir() && h.servePrecompressed(w, r, fs, name) {
+		return
+	}
+
+	h.setHeaders(w, r, fs, name)
+	if r.Method == http.MethodHead && err == nil && !fi.IsDir() {
+		h.setHeadContentType(w, fs, name)
+	}
+	http.FileServer(fs).ServeHTTP(w, r)
+}
+
+// Serve the index file of the directory at name, or redirect to the
+// directory with a trailing slash if it has one. Reports false if nothing
+// was written, leaving index.html to http.FileServer unless listings are
+// disabled
+func (h *handler) serveIndex(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) bool {
+	indexes := h.indexes
+	if len(indexes) == 0 {
+		if !h.noListings {
+			return false
+		}
+		indexes = []string{"index.html"}
+	}
+
+	for _, index := range indexes {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			if fi, ok := stat(fs, path.Join(name, index)); ok && !fi.IsDir() {
+				localRedirect(w, r, path.Base(r.URL.Path)+"/")
+				return true
+			}
+			continue
+		}
+		if h.serveFile(w, r, fs, path.Join(name, index)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redirect to a path relative to the request, like http.FileServer does
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// Set the headers derived from the file at name
+func (h *handler) setHeaders(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) {
+	h.setBlobHeaders(w, fs, name)
+	if h.attrs != nil {
+		if ct, ok := h.attrs.get(fs, name, ContentTypeAttribute); ok {
+			w.Header().Set("Content-Type", ct)
+		}
+	}
+	h.setCacheControl(w, r, fs, name)
+}
+
+// Set the ETag and X-Git-Blob of the blob served for the file at name
+func (h *handler) setBlobHeaders(w http.ResponseWriter, fs http.FileSystem, name string) {
+	if etag, ok := blobETag(fs, name); ok {
+		w.Header().Set("ETag", etag)
+		if h.gitHeaders {
+			w.Header().Set("X-Git-Blob", strings.Trim(etag, `"`))
+		}
+	}
+}
+
+// Serve the regular file at name. Report false without writing a
+// response if it doesn't exist or is a directory
+func (h *handler) serveFile(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+
+	h.setHeaders(w, r, fs, name)
+	if r.Method == http.MethodHead {
+		h.setHeadContentType(w, fs, name)
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+	return true
+}
+
+// Serve the file at name of fs with http.ServeContent. Blobs get their
+// object id as ETag and the ModTime of fs as Last-Modified, so
+// conditional and range requests work together. Requests for multiple
+// ranges are answered with multipart/byteranges, in the requested order,
+// also for streamed blobs. Directories are served by Handler, as if
+// requested at name
+func ServeFile(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) {
+	fs = WithContext(r.Context(), fs)
+	f, err := fs.Open(name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if fi.IsDir() {
+		u := *r.URL
+		u.Path = name
+		r2 := *r
+		r2.URL = &u
+		Handler(fs).ServeHTTP(w, &r2)
+		return
+	}
+
+	if entry, ok := fi.Sys().(*g.TreeEntry); ok && entry.Type == g.ObjectBlob {
+		w.Header().Set("ETag", `"`+entry.Id.String()+`"`)
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+// Respond with the status matching err, like http.FileServer
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case os.IsNotExist(err):
+		code = http.StatusNotFound
+	case os.IsPermission(err):
+		code = http.StatusForbidden
+	case tooLarge(err):
+		code = http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+func tooLarge(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return errors.Cause(err) == ErrFileTooLarge
+}
+
+func stat(fs http.FileSystem, name string) (os.FileInfo, bool) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	return fi, err == nil
+}
+
+type ctxfs struct {
+	ctx context.Context
+	fs  ContextFileSystem
+}
+
+// Bind ctx to a ContextFileSystem, so its Open calls OpenContext. Other
+// filesystems are returned unchanged
+func WithContext(ctx context.Context, fs http.FileSystem) http.FileSystem {
+	cfs, ok := fs.(ContextFileSystem)
+	if !ok {
+		return fs
+	}
+	return ctxfs{ctx, cfs}
+}
+
+func (c ctxfs) Open(name string) (http.File, error) {
+	return c.fs.OpenContext(c.ctx, name)
+}
+
+// Return the quoted object id of the blob at name
+func blobETag(fs http.FileSystem, name string) (string, bool) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", false
+	}
+	entry, ok := fi.Sys().(*g.TreeEntry)
+	if !ok || entry.Type != g.ObjectBlob {
+		return "", false
+	}
+	return `"` + entry.Id.String() + `"`, true
+}
+
+// Redirect requests for symlinks to their target with 302 Found instead
+// of passing them to next, which by default serves the link target as
+// the file content. Targets escaping the root are passed to next as well
+func RedirectSymlinks(fs http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target, ok := symlinkTarget(fs, r.URL.Path); ok {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Resolve the target of the symlink at name to an absolute path
+func symlinkTarget(fs http.FileSystem, name string) (string, bool) {
+	fi, ok := stat(fs, name)
+	if !ok || fi.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
+	target, err := readlink(fs, name)
+	if err != nil || path.IsAbs(target) {
+		return "", false
+	}
+
+	target, ok = cleanPath(path.Join(path.Dir(strings.Trim(name, "/")), target))
+	if !ok {
+		return "", false
+	}
+	return "/" + target, true
+}
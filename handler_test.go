@@ -0,0 +1,712 @@
+package ghfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIfModifiedSince(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a.txt": "a", "d/b.txt": "b"})
+	hfs := FromCommit(commit)
+	modified := fixtureTime.Format(http.TimeFormat)
+
+	for _, h := range []struct {
+		name string
+		h    http.Handler
+	}{
+		{"Handler", Handler(hfs)},
+		{"http.FileServer", http.FileServer(hfs)},
+	} {
+		for _, p := range []string{"/a.txt", "/d/", "/"} {
+			tests := []struct {
+				since string
+				code  int
+			}{
+				{modified, http.StatusNotModified},
+				{fixtureTime.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+				{fixtureTime.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+			}
+			for _, test := range tests {
+				r := httptest.NewRequest("GET", p, nil)
+				r.Header.Set("If-Modified-Since", test.since)
+				w := httptest.NewRecorder()
+				h.h.ServeHTTP(w, r)
+				if w.Code != test.code {
+					t.Errorf("%s: GET %s since %s = %d, want %d", h.name, p, test.since, w.Code, test.code)
+				}
+				if lm := w.Header().Get("Last-Modified"); test.code == http.StatusOK && lm != modified {
+					t.Errorf("%s: GET %s: Last-Modified %q, want %q", h.name, p, lm, modified)
+				}
+			}
+		}
+	}
+}
+
+func TestMultipartRanges(t *testing.T) {
+	content := blobContent(1 << 20)
+	_, commit := newRepo(t, map[string]string{"blob": content})
+	wrapBlobData(t, func(rc io.ReadCloser) io.ReadCloser {
+		return shortReader{rc}
+	})
+
+	tests := []struct {
+		rng   string
+		parts [][2]int
+	}{
+		{"bytes=0-9,20-29", [][2]int{{0, 10}, {20, 30}}},
+		// Scattered and out of order, seeking backwards in between
+		{"bytes=900000-900009,10-19,1048000-1048575", [][2]int{{900000, 900010}, {10, 20}, {1048000, 1048576}}},
+	}
+	for _, mode := range readModes {
+		h := Handler(FromCommit(commit, mode.opt))
+		for _, test := range tests {
+			r := httptest.NewRequest("GET", "/blob", nil)
+			r.Header.Set("Range", test.rng)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusPartialContent {
+				t.Fatalf("%s: %s: status %d", mode.name, test.rng, w.Code)
+			}
+			mt, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+			if err != nil || mt != "multipart/byteranges" {
+				t.Fatalf("%s: %s: Content-Type %q", mode.name, test.rng, w.Header().Get("Content-Type"))
+			}
+
+			mr := multipart.NewReader(w.Body, params["boundary"])
+			for i, p := range test.parts {
+				part, err := mr.NextPart()
+				if err != nil {
+					t.Fatalf("%s: %s: part %d: %v", mode.name, test.rng, i, err)
+				}
+				want := fmt.Sprintf("bytes %d-%d/%d", p[0], p[1]-1, len(content))
+				if cr := part.Header.Get("Content-Range"); cr != want {
+					t.Errorf("%s: %s: part %d: Content-Range %q, want %q", mode.name, test.rng, i, cr, want)
+				}
+				data, err := io.ReadAll(part)
+				if err != nil || string(data) != content[p[0]:p[1]] {
+					t.Errorf("%s: %s: part %d = %q, %v, want %q", mode.name, test.rng, i, data, err, content[p[0]:p[1]])
+				}
+			}
+			if _, err := mr.NextPart(); err != io.EOF {
+				t.Errorf("%s: %s: got %v after the last part, want EOF", mode.name, test.rng, err)
+			}
+		}
+	}
+}
+
+func TestHeadReadsNoData(t *testing.T) {
+	big := blobContent(5 << 20)
+	_, commit := newRepo(t, map[string]string{
+		".gitattributes": "typed ghfs-content-type=text/x-typed\n",
+		"a.txt":          "a",
+		"noext":          "plain text",
+		"typed":          "typed",
+		"big":            big,
+		"big.txt":        big,
+		"app.js":         "js",
+		"app.js.gz":      "gzipped js",
+		"dir/README":     "readme",
+	})
+	h := Handler(FromCommit(commit),
+		WithContentTypeAttribute(),
+		WithPrecompressed(),
+		WithIndexFiles("README"),
+	)
+
+	tests := []struct {
+		path   string
+		ctype  string
+		length int
+	}{
+		{"/a.txt", "text/plain; charset=utf-8", 1},
+		{"/noext", "", len("plain text")},
+		{"/typed", "text/x-typed", len("typed")},
+		{"/big", "", len(big)},
+		{"/big.txt", "text/plain; charset=utf-8", len(big)},
+		// http.ServeContent sets no Content-Length with Content-Encoding
+		{"/app.js", "text/javascript; charset=utf-8", -1},
+		{"/dir/", "", len("readme")},
+	}
+	head := func(p string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("HEAD", p, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	// Read the .gitattributes before counting
+	for _, test := range tests {
+		head(test.path)
+	}
+
+	reads := countBlobReads(t)
+	for _, test := range tests {
+		w := head(test.path)
+		if w.Code != http.StatusOK {
+			t.Errorf("HEAD %s = %d", test.path, w.Code)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.ctype {
+			t.Errorf("HEAD %s: Content-Type %q, want %q", test.path, ct, test.ctype)
+		}
+		if cl := w.Header().Get("Content-Length"); test.length >= 0 && cl != fmt.Sprint(test.length) {
+			t.Errorf("HEAD %s: Content-Length %s, want %d", test.path, cl, test.length)
+		}
+		if w.Header().Get("ETag") == "" || w.Header().Get("Last-Modified") == "" {
+			t.Errorf("HEAD %s: no ETag or Last-Modified in %v", test.path, w.Header())
+		}
+	}
+	if n := reads.Load(); n != 0 {
+		t.Errorf("HEAD requests read blobs %d times", n)
+	}
+
+	// GET still sniffs
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/noext", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("GET /noext: Content-Type %q", ct)
+	}
+	if reads.Load() == 0 {
+		t.Error("GET read no blob")
+	}
+}
+
+func TestHeadReadsNoDataRules(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{
+		"a.txt":   "a",
+		"noext":   "plain text",
+		"missing": "<html>not found</html>",
+	})
+	h := Handler(FromCommit(commit),
+		WithCacheControlType("text/*", "max-age=60"),
+		WithNotFoundFile("missing"),
+	)
+
+	tests := []struct {
+		path   string
+		status int
+		cache  string
+	}{
+		{"/a.txt", http.StatusOK, "max-age=60"},
+		// Only sniffing could tell the type of noext and missing
+		{"/noext", http.StatusOK, ""},
+		{"/nope", http.StatusNotFound, ""},
+	}
+	reads := countBlobReads(t)
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("HEAD", test.path, nil))
+		if w.Code != test.status || w.Header().Get("Cache-Control") != test.cache {
+			t.Errorf("HEAD %s = %d, Cache-Control %q, want %d, %q", test.path, w.Code, w.Header().Get("Cache-Control"), test.status, test.cache)
+		}
+		if ct := w.Header().Get("Content-Type"); test.path != "/a.txt" && ct != "" {
+			t.Errorf("HEAD %s: Content-Type %q, want none", test.path, ct)
+		}
+	}
+	if n := reads.Load(); n != 0 {
+		t.Errorf("HEAD requests read blobs %d times", n)
+	}
+
+	// GET sniffs for the rules and the not found page
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/noext", nil))
+	if cc := w.Header().Get("Cache-Control"); cc != "max-age=60" {
+		t.Errorf("GET /noext: Cache-Control %q, want max-age=60", cc)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/nope", nil))
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusNotFound || ct != "text/html; charset=utf-8" {
+		t.Errorf("GET /nope = %d, Content-Type %q", w.Code, ct)
+	}
+}
+
+func TestPrecompressedHeaders(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"app.js": "js", "app.js.gz": "gzipped js"})
+	h := Handler(FromCommit(commit),
+		WithPrecompressed(),
+		WithGitHeaders("master"),
+		WithCacheControl("*.js", "max-age=60"),
+	)
+
+	for _, test := range []struct {
+		encoding, blob string
+	}{
+		{"gzip", f.git("rev-parse", "HEAD:app.js.gz")},
+		{"", f.git("rev-parse", "HEAD:app.js")},
+	} {
+		for _, method := range []string{"GET", "HEAD"} {
+			r := httptest.NewRequest(method, "/app.js", nil)
+			r.Header.Set("Accept-Encoding", test.encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			for key, want := range map[string]string{
+				"Content-Encoding": test.encoding,
+				"Content-Type":     "text/javascript; charset=utf-8",
+				"ETag":             `"` + test.blob + `"`,
+				"X-Git-Blob":       test.blob,
+				"X-Git-Commit":     commit.Id.String(),
+				"X-Git-Ref":        "master",
+				"Cache-Control":    "max-age=60",
+			} {
+				if got := w.Header().Get(key); got != want {
+					t.Errorf("%s /app.js with %q: %s %q, want %q", method, test.encoding, key, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestServeFile(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"a.txt": "0123456789", "d/b.txt": "b"})
+	hfs := FromCommit(commit)
+	etag := `"` + f.git("rev-parse", "HEAD:a.txt") + `"`
+	serve := func(name string, header map[string]string) *httptest.ResponseRecorder {
+		// The request path differs from the served name
+		r := httptest.NewRequest("GET", "/other", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		ServeFile(w, r, hfs, name)
+		return w
+	}
+
+	w := serve("/a.txt", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("a.txt = %d, %q", w.Code, w.Body)
+	}
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("a.txt: ETag %s, want %s", got, etag)
+	}
+	if got, want := w.Header().Get("Last-Modified"), fixtureTime.Format(http.TimeFormat); got != want {
+		t.Errorf("a.txt: Last-Modified %q, want %q", got, want)
+	}
+
+	for _, test := range []struct {
+		header map[string]string
+		code   int
+		body   string
+	}{
+		{map[string]string{"If-None-Match": etag}, http.StatusNotModified, ""},
+		{map[string]string{"If-None-Match": `"other"`}, http.StatusOK, "0123456789"},
+		{map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "234"},
+		// The range only applies if the ETag still matches
+		{map[string]string{"Range": "bytes=2-4", "If-Range": etag}, http.StatusPartialContent, "234"},
+		{map[string]string{"Range": "bytes=2-4", "If-Range": `"other"`}, http.StatusOK, "0123456789"},
+	} {
+		if w := serve("/a.txt", test.header); w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("a.txt with %v = %d, %q, want %d, %q", test.header, w.Code, w.Body, test.code, test.body)
+		}
+	}
+
+	if w := serve("/nope", nil); w.Code != http.StatusNotFound {
+		t.Errorf("nope = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	// Directories are served by Handler at name
+	if w := serve("/d", nil); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "d/" {
+		t.Errorf("d = %d to %q, want %d to d/", w.Code, w.Header().Get("Location"), http.StatusMovedPermanently)
+	}
+	if w := serve("/d/", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "b.txt") {
+		t.Errorf("d/ = %d, %q, want a listing", w.Code, w.Body)
+	}
+}
+
+func TestMountAt(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a.txt": "a", "d/b.txt": "b"})
+	hfs := FromCommit(commit)
+
+	for _, prefix := range []string{"/site/", "site", "/site"} {
+		h := MountAt(prefix, hfs)
+		for _, test := range []struct {
+			path     string
+			code     int
+			location string
+			body     string
+		}{
+			{"/site", http.StatusMovedPermanently, "/site/", ""},
+			{"/site/", http.StatusOK, "", "a.txt"},
+			{"/site/a.txt", http.StatusOK, "", "a"},
+			{"/site/d", http.StatusMovedPermanently, "/site/d/", ""},
+			{"/site/d/b.txt", http.StatusOK, "", "b"},
+			{"/site/nope", http.StatusNotFound, "", ""},
+			{"/a.txt", http.StatusNotFound, "", ""},
+			{"/sitemap/a.txt", http.StatusNotFound, "", ""},
+		} {
+			r := httptest.NewRequest("GET", test.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Errorf("%s: GET %s = %d, want %d", prefix, test.path, w.Code, test.code)
+				continue
+			}
+			if test.location != "" {
+				loc, err := r.URL.Parse(w.Header().Get("Location"))
+				if err != nil || loc.Path != test.location {
+					t.Errorf("%s: GET %s redirects to %q, want %s", prefix, test.path, w.Header().Get("Location"), test.location)
+				}
+			}
+			if test.body != "" && !strings.Contains(w.Body.String(), test.body) {
+				t.Errorf("%s: GET %s = %q, want %q", prefix, test.path, w.Body, test.body)
+			}
+		}
+	}
+
+	// Without a prefix it is the plain Handler
+	w := httptest.NewRecorder()
+	MountAt("/", hfs).ServeHTTP(w, httptest.NewRequest("GET", "/a.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "a" {
+		t.Errorf("GET /a.txt at / = %d, %q", w.Code, w.Body)
+	}
+}
+
+func TestMaxListEntries(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"big/e": "", "big/d": "", "big/c": "", "big/b": "", "big/a": "", "small/a": "", "small/b": ""})
+	h := Handler(FromCommit(commit), WithMaxListEntries(3), WithJSONListings())
+
+	for _, test := range []struct {
+		dir    string
+		listed []string
+		total  string
+	}{
+		{"/big/", []string{"a", "b", "c"}, "5"},
+		{"/small/", []string{"a", "b"}, ""},
+	} {
+		for _, query := range []string{"", "?format=json"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", test.dir+query, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("GET %s%s = %d", test.dir, query, w.Code)
+				continue
+			}
+			if total := w.Header().Get(ListingTotalHeader); total != test.total {
+				t.Errorf("GET %s%s: %s %q, want %q", test.dir, query, ListingTotalHeader, total, test.total)
+			}
+
+			var names []string
+			if query == "" {
+				for _, name := range []string{"a", "b", "c", "d", "e"} {
+					if strings.Contains(w.Body.String(), `href="`+name+`"`) {
+						names = append(names, name)
+					}
+				}
+			} else {
+				var entries []ListEntry
+				if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+					t.Errorf("GET %s%s: %v", test.dir, query, err)
+				}
+				for _, e := range entries {
+					names = append(names, e.Name)
+				}
+			}
+			if !reflect.DeepEqual(names, test.listed) {
+				t.Errorf("GET %s%s lists %q, want %q", test.dir, query, names, test.listed)
+			}
+		}
+	}
+
+	// Files are served as usual
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/big/e", nil))
+	if w.Code != http.StatusOK || w.Header().Get(ListingTotalHeader) != "" {
+		t.Errorf("GET /big/e = %d, %v", w.Code, w.Header())
+	}
+}
+
+func TestETag(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"a.txt": "a", "d/b.txt": "b"})
+	h := Handler(FromCommit(commit))
+	etag := `"` + f.git("rev-parse", "HEAD:a.txt") + `"`
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/a.txt", nil))
+	if got := w.Header().Get("ETag"); w.Code != http.StatusOK || got != etag {
+		t.Errorf("GET /a.txt = %d, ETag %s, want %s", w.Code, got, etag)
+	}
+
+	for _, test := range []struct {
+		inm  string
+		code int
+	}{
+		{etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	} {
+		for _, method := range []string{"GET", "HEAD"} {
+			r := httptest.NewRequest(method, "/a.txt", nil)
+			r.Header.Set("If-None-Match", test.inm)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Errorf("%s /a.txt with If-None-Match %s = %d, want %d", method, test.inm, w.Code, test.code)
+			}
+			if test.code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("%s /a.txt with If-None-Match %s: body %q", method, test.inm, w.Body)
+			}
+		}
+	}
+
+	// Directories have no blob and no ETag
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/d/", nil))
+	if got := w.Header().Get("ETag"); got != "" {
+		t.Errorf("GET /d/: ETag %s", got)
+	}
+}
+
+func TestGitHeaders(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"a.txt": "a", "d/b.txt": "b"})
+	blob := f.git("rev-parse", "HEAD:a.txt")
+	hfs := FromCommit(commit)
+
+	for _, test := range []struct {
+		name string
+		h    http.Handler
+		path string
+		want map[string]string
+	}{
+		{"file", Handler(hfs, WithGitHeaders("main")), "/a.txt",
+			map[string]string{"X-Git-Commit": commit.Id.String(), "X-Git-Ref": "main", "X-Git-Blob": blob}},
+		{"directory", Handler(hfs, WithGitHeaders("main")), "/d/",
+			map[string]string{"X-Git-Commit": commit.Id.String(), "X-Git-Ref": "main", "X-Git-Blob": ""}},
+		{"not found", Handler(hfs, WithGitHeaders("main")), "/nope",
+			map[string]string{"X-Git-Commit": commit.Id.String(), "X-Git-Ref": "main", "X-Git-Blob": ""}},
+		{"no ref", Handler(hfs, WithGitHeaders("")), "/a.txt",
+			map[string]string{"X-Git-Commit": commit.Id.String(), "X-Git-Ref": "", "X-Git-Blob": blob}},
+		// Not a GitFileSystem
+		{"http.Dir", Handler(http.Dir(f.dir), WithGitHeaders("main")), "/a.txt",
+			map[string]string{"X-Git-Commit": "", "X-Git-Ref": "main", "X-Git-Blob": ""}},
+		{"without option", Handler(hfs), "/a.txt",
+			map[string]string{"X-Git-Commit": "", "X-Git-Ref": "", "X-Git-Blob": ""}},
+	} {
+		w := httptest.NewRecorder()
+		test.h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		for key, want := range test.want {
+			if got := w.Header().Get(key); got != want {
+				t.Errorf("%s: GET %s: %s %q, want %q", test.name, test.path, key, got, want)
+			}
+		}
+	}
+}
+
+func TestNotFoundFile(t *testing.T) {
+	page := "<html>not here</html>"
+	_, commit := newRepo(t, map[string]string{"a.txt": "a", "404.html": page, "d/b.txt": "b"})
+	hfs := FromCommit(commit)
+
+	for _, test := range []struct {
+		name string
+		h    http.Handler
+		path string
+		code int
+		body string
+	}{
+		{"missing file", Handler(hfs, WithNotFoundFile("404.html")), "/nope", http.StatusNotFound, page},
+		{"missing directory", Handler(hfs, WithNotFoundFile("/404.html")), "/nope/x/", http.StatusNotFound, page},
+		{"existing file", Handler(hfs, WithNotFoundFile("404.html")), "/a.txt", http.StatusOK, "a"},
+		{"WithoutListings", Handler(hfs, WithNotFoundFile("404.html"), WithoutListings()), "/d/", http.StatusNotFound, page},
+		{"missing page", Handler(hfs, WithNotFoundFile("nope.html")), "/nope", http.StatusNotFound, "404 page not found\n"},
+		{"page is a directory", Handler(hfs, WithNotFoundFile("d")), "/nope", http.StatusNotFound, "404 page not found\n"},
+	} {
+		w := httptest.NewRecorder()
+		test.h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: GET %s = %d, %q, want %d, %q", test.name, test.path, w.Code, w.Body, test.code, test.body)
+		}
+		if test.body == page {
+			if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+				t.Errorf("%s: Content-Type %q", test.name, ct)
+			}
+			if cl := w.Header().Get("Content-Length"); cl != fmt.Sprint(len(page)) {
+				t.Errorf("%s: Content-Length %s, want %d", test.name, cl, len(page))
+			}
+		}
+	}
+}
+
+func TestSPAFallback(t *testing.T) {
+	app := "<html>app</html>"
+	_, commit := newRepo(t, map[string]string{
+		"index.html": app, "about.html": "about", "assets/app.js": "js", "docs/index.html": "docs", "404.html": "missing",
+	})
+	hfs := FromCommit(commit)
+
+	for _, test := range []struct {
+		h    http.Handler
+		path string
+		code int
+		body string
+	}{
+		// Real files and directories are not masked
+		{Handler(hfs, WithSPAFallback("index.html")), "/about.html", http.StatusOK, "about"},
+		{Handler(hfs, WithSPAFallback("index.html")), "/assets/app.js", http.StatusOK, "js"},
+		{Handler(hfs, WithSPAFallback("index.html")), "/docs/", http.StatusOK, "docs"},
+		// Routes get the app
+		{Handler(hfs, WithSPAFallback("index.html")), "/users/42", http.StatusOK, app},
+		{Handler(hfs, WithSPAFallback("/index.html")), "/users/42/", http.StatusOK, app},
+		{Handler(hfs, WithSPAFallback("index.html")), "/page.html", http.StatusOK, app},
+		// Missing assets are still not found
+		{Handler(hfs, WithSPAFallback("index.html")), "/assets/missing.js", http.StatusNotFound, "404 page not found\n"},
+		{Handler(hfs, WithSPAFallback("index.html"), WithNotFoundFile("404.html")), "/style.css", http.StatusNotFound, "missing"},
+		// A missing fallback is not found
+		{Handler(hfs, WithSPAFallback("nope.html")), "/users/42", http.StatusNotFound, "404 page not found\n"},
+	} {
+		w := httptest.NewRecorder()
+		test.h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("GET %s = %d, %q, want %d, %q", test.path, w.Code, w.Body, test.code, test.body)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{
+		".gitattributes":     "*.data ghfs-content-type=text/x-data\n",
+		"index.html":         "<html>",
+		"assets/app.js":      "js",
+		"assets/v1/old.html": "<html>",
+		"page.html":          "<html>",
+		"style.css":          "css",
+		"noext":              "plain text",
+		"t.data":             "data",
+		"docs/a.txt":         "a",
+	})
+	h := Handler(FromCommit(commit),
+		WithContentTypeAttribute(),
+		WithCacheControl("assets/**", "max-age=31536000, immutable"),
+		WithCacheControlType("text/html", "no-cache"),
+		WithCacheControl("*.css", "max-age=60"),
+		WithCacheControlType("text/*", "max-age=300"),
+	)
+
+	for _, test := range []struct {
+		path, want string
+	}{
+		// The first matching rule wins, whatever its kind
+		{"/assets/app.js", "max-age=31536000, immutable"},
+		{"/assets/v1/old.html", "max-age=31536000, immutable"},
+		{"/page.html", "no-cache"},
+		{"/style.css", "max-age=60"},
+		// Types from the content and from the gitattributes
+		{"/noext", "max-age=300"},
+		{"/t.data", "max-age=300"},
+		// Directories get the rule of their index.html
+		{"/", "no-cache"},
+		{"/docs/", ""},
+		{"/docs/a.txt", "max-age=300"},
+		{"/nope", ""},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if got := w.Header().Get("Cache-Control"); got != test.want {
+			t.Errorf("GET %s: Cache-Control %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestWithoutListings(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{
+		"a.txt": "a", "empty/x/y": "", "site/index.html": "site", "docs/README": "readme", "docs/sub/a": "a",
+	})
+	hfs := FromCommit(commit)
+
+	for _, test := range []struct {
+		name string
+		h    http.Handler
+		path string
+		code int
+		body string
+	}{
+		{"root", Handler(hfs, WithoutListings()), "/", http.StatusNotFound, "404 page not found\n"},
+		{"directory", Handler(hfs, WithoutListings()), "/empty/", http.StatusNotFound, "404 page not found\n"},
+		{"JSON", Handler(hfs, WithoutListings(), WithJSONListings()), "/empty/?format=json", http.StatusNotFound, "404 page not found\n"},
+		{"index.html", Handler(hfs, WithoutListings()), "/site/", http.StatusOK, "site"},
+		{"index.html without slash", Handler(hfs, WithoutListings()), "/site", http.StatusMovedPermanently, ""},
+		{"WithIndexFiles", Handler(hfs, WithoutListings(), WithIndexFiles("README")), "/docs/", http.StatusOK, "readme"},
+		{"WithIndexFiles without index", Handler(hfs, WithoutListings(), WithIndexFiles("README")), "/docs/sub/", http.StatusNotFound, "404 page not found\n"},
+		{"file", Handler(hfs, WithoutListings()), "/a.txt", http.StatusOK, "a"},
+		// Listings are on by default
+		{"default", Handler(hfs), "/empty/", http.StatusOK, `<a href="x/">x/</a>`},
+	} {
+		w := httptest.NewRecorder()
+		test.h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s: GET %s = %d, %q, want %d, %q", test.name, test.path, w.Code, w.Body, test.code, test.body)
+		}
+		if body := w.Body.String(); test.code == http.StatusNotFound && body != test.body {
+			t.Errorf("%s: GET %s: body %q, want %q", test.name, test.path, body, test.body)
+		}
+	}
+}
+
+func TestJSONListing(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"d/a.txt": "abc", "d/run*": "#!", "d/link@": "a.txt", "d/sub/x": "x"})
+	h := Handler(FromCommit(commit), WithJSONListings())
+	modTime := fixtureTime.Format(time.RFC3339)
+	sha := func(name string) string {
+		return f.git("rev-parse", "HEAD:d/"+name)
+	}
+	want := []map[string]interface{}{
+		{"name": "a.txt", "size": 3.0, "mode": float64(0644), "modTime": modTime, "isDir": false, "sha": sha("a.txt")},
+		{"name": "link", "size": 5.0, "mode": float64(os.ModeSymlink | 0777), "modTime": modTime, "isDir": false, "sha": sha("link")},
+		{"name": "run", "size": 2.0, "mode": float64(0755), "modTime": modTime, "isDir": false, "sha": sha("run")},
+		{"name": "sub", "size": 0.0, "mode": float64(os.ModeDir | 0755), "modTime": modTime, "isDir": true, "sha": sha("sub")},
+	}
+
+	for _, test := range []struct {
+		path, accept string
+	}{
+		{"/d/?format=json", ""},
+		{"/d/", "application/json"},
+		{"/d/", "text/html;q=0.9, application/json; charset=utf-8"},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "application/json" {
+			t.Errorf("GET %s with %q = %d, Content-Type %q", test.path, test.accept, w.Code, ct)
+			continue
+		}
+		var got []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Errorf("GET %s with %q: %v", test.path, test.accept, err)
+		}
+		sort.Slice(got, func(i, j int) bool {
+			return got[i]["name"].(string) < got[j]["name"].(string)
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GET %s with %q =\n%v\nwant\n%v", test.path, test.accept, got, want)
+		}
+	}
+
+	// HTML without the option or a request for JSON
+	for _, test := range []struct {
+		h      http.Handler
+		path   string
+		accept string
+	}{
+		{h, "/d/", "text/html"},
+		{Handler(FromCommit(commit)), "/d/?format=json", "application/json"},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		test.h.ServeHTTP(w, r)
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("GET %s with %q: Content-Type %q, want HTML", test.path, test.accept, ct)
+		}
+	}
+}
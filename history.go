@@ -0,0 +1,97 @@
+package ghfs
+
+import (
+	"path"
+	"sync"
+	"time"
+
+	g "github.com/gogits/git"
+)
+
+// Report the author time of the last commit that changed an entry as
+// its ModTime, instead of the time of the served commit. History is
+// followed along first parents and the result is cached per path. Has no
+// effect for filesystems without a commit
+func WithLastChangeModTime() Option {
+	return func(fs *ghfs) {
+		fs.modTimeOf = (&history{times: map[string]*lastChangeTime{}}).modTime
+	}
+}
+
+type history struct {
+	mu    sync.Mutex
+	times map[string]*lastChangeTime
+}
+
+// The ModTime of a path, looked up once. Concurrent lookups of the same
+// path wait for the first one, other paths are looked up in parallel
+type lastChangeTime struct {
+	once sync.Once
+	t    time.Time
+}
+
+func (h *history) modTime(fs ghfs, name string, entry *g.TreeEntry) time.Time {
+	if fs.commit == nil || entry == nil {
+		return fs.modTime
+	}
+
+	h.mu.Lock()
+	lc, ok := h.times[name]
+	if !ok {
+		lc = &lastChangeTime{}
+		h.times[name] = lc
+	}
+	h.mu.Unlock()
+
+	lc.once.Do(func() {
+		cpath, err := fs.commitPath(name)
+		if err != nil {
+			// Without a path there is no history to look at
+			lc.t = fs.modTime
+			return
+		}
+		lc.t = lastChange(fs.commit, cpath, entry).Author.When
+	})
+	return lc.t
+}
+
+// Find the oldest commit along first parents of commit in which the entry
+// at name is unchanged
+func lastChange(commit *g.Commit, name string, entry *g.TreeEntry) *g.Commit {
+	for commit.ParentCount() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			break
+		}
+		pentry, err := parent.GetTreeEntryByPath(name)
+		if err != nil || pentry.Id != entry.Id {
+			break
+		}
+		commit = parent
+	}
+	return commit
+}
+
+// Append the paths of the trees with object id id below root to paths.
+// The search stops at the second match
+func treePaths(root *g.Tree, id, prefix string, paths []string) []string {
+	if root.Id.String() == id {
+		return append(paths, prefix)
+	}
+	scanner, err := root.Scanner()
+	if err != nil {
+		return paths
+	}
+	for scanner.Scan() && len(paths) < 2 {
+		entry := scanner.TreeEntry()
+		if entry.Type != g.ObjectTree {
+			continue
+		}
+		sub, err := root.SubTree(entry.Name())
+		if err != nil {
+			continue
+		}
+		paths = treePaths(sub, id, path.Join(prefix, entry.Name()), paths)
+	}
+	return paths
+}
@@ -0,0 +1,58 @@
+package ghfs
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLastChangeModTime(t *testing.T) {
+	f, _ := newRepo(t, map[string]string{"a": "a", "b": "b", "d/c": "c", "e/x": "x"})
+	f.write("b", "b2")
+	f.commit("Change b")
+	f.write("d/c", "c2")
+	f.commit("Change d/c")
+	// Changed and changed back, the blob is the same as in the first commit
+	f.write("a", "a2")
+	f.commit("Change a")
+	f.write("a", "a")
+	f.write("e/y", "y")
+	commit := f.commit("Revert a, add e/y")
+
+	hour := func(n int) time.Time {
+		return fixtureTime.Add(time.Duration(n) * time.Hour)
+	}
+	hfs := FromCommit(commit, WithLastChangeModTime())
+	sub, err := Sub(hfs, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		hfs  http.FileSystem
+		path string
+		want time.Time
+	}{
+		{"FromCommit", hfs, "/a", hour(4)},
+		{"FromCommit", hfs, "/b", hour(1)},
+		{"FromCommit", hfs, "/d", hour(2)},
+		{"FromCommit", hfs, "/d/c", hour(2)},
+		{"FromCommit", hfs, "/e", hour(4)},
+		{"FromCommit", hfs, "/e/x", hour(0)},
+		{"FromCommit", hfs, "/e/y", hour(4)},
+		// The root has no entry and gets the time of the commit
+		{"FromCommit", hfs, "/", hour(4)},
+		{"Sub", sub, "/c", hour(2)},
+	} {
+		// Twice, the second time from the cache
+		for i := 0; i < 2; i++ {
+			fi, ok := stat(test.hfs, test.path)
+			if !ok {
+				t.Fatalf("%s: cannot stat %s", test.name, test.path)
+			}
+			if got := fi.ModTime(); !got.Equal(test.want) {
+				t.Errorf("%s: ModTime of %s = %v, want %v", test.name, test.path, got, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ghfs
+
+import (
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// Look up tree entries in a map of all paths of the served tree instead of
+// walking the tree objects. The map is built on the first lookup by
+// reading every tree once. Trees with more than maxEntries entries are not
+// indexed and looked up as without this option, maxEntries <= 0 indexes
+// trees of any size
+func WithPathIndex(maxEntries int) Option {
+	return func(fs *ghfs) {
+		fs.index = &pathIndex{max: maxEntries}
+	}
+}
+
+// Entries by path, shared by the copies of a filesystem
+type pathIndex struct {
+	once    sync.Once
+	max     int
+	entries map[string]*g.TreeEntry
+}
+
+// Look up the entry at name like tree.GetTreeEntryByPath. Entries are
+// copied, as they cache their size
+func (idx *pathIndex) get(tree *g.Tree, name string) (*g.TreeEntry, error) {
+	idx.once.Do(func() {
+		entries := map[string]*g.TreeEntry{}
+		if err := indexTree(entries, tree, "", idx.max); err == nil {
+			idx.entries = entries
+		}
+	})
+	if idx.entries == nil {
+		return tree.GetTreeEntryByPath(name)
+	}
+
+	entry, ok := idx.entries[name]
+	if !ok {
+		return nil, g.ErrNotExist
+	}
+	e := *entry
+	return &e, nil
+}
+
+var errIndexFull = errors.New("Too many entries to index")
+
+func indexTree(entries map[string]*g.TreeEntry, tree *g.Tree, prefix string, max int) error {
+	scanner, err := tree.Scanner()
+	if err != nil {
+		return errors.Wrap(err, "Cannot open scanner.")
+	}
+	for scanner.Scan() {
+		entry := scanner.TreeEntry()
+		name := path.Join(prefix, entry.Name())
+		if max > 0 && len(entries) >= max {
+			return errIndexFull
+		}
+		entries[name] = entry
+		if entry.Type != g.ObjectTree {
+			continue
+		}
+		sub, err := tree.SubTree(entry.Name())
+		if err != nil {
+			return errors.Wrap(err, "Cannot get subtree.")
+		}
+		if err := indexTree(entries, sub, name, max); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(scanner.Err(), "Cannot scan tree.")
+}
+
+// Look up the entry at name of the served tree, through the index if
+// configured
+func (fs ghfs) entryByPath(name string) (*g.TreeEntry, error) {
+	if fs.index == nil {
+		return fs.tree.GetTreeEntryByPath(name)
+	}
+	return fs.index.get(fs.tree, name)
+}
+
+// Paths of the blobs of the served tree by object id, built on the first
+// OpenBlob and shared by the copies of a filesystem
+type blobIndex struct {
+	once sync.Once
+	err  error
+	// First path in depth first order and its entry
+	blobs map[string]blobPath
+}
+
+type blobPath struct {
+	name  string
+	entry *g.TreeEntry
+}
+
+// Return the path and a copy of the entry of the blob with object id sha,
+// or a nil entry if the served tree has none
+func (idx *blobIndex) get(fs ghfs, sha string) (string, *g.TreeEntry, error) {
+	idx.once.Do(func() {
+		idx.blobs = map[string]blobPath{}
+		idx.err = fs.indexBlobs(idx.blobs, fs.tree, "")
+	})
+	if idx.err != nil {
+		return "", nil, idx.err
+	}
+
+	b, ok := idx.blobs[sha]
+	if !ok {
+		return "", nil, nil
+	}
+	e := *b.entry
+	return b.name, &e, nil
+}
+
+func (fs ghfs) indexBlobs(blobs map[string]blobPath, tree *g.Tree, prefix string) error {
+	scanner, err := tree.Scanner()
+	if err != nil {
+		return errors.Wrap(err, "Cannot open scanner.")
+	}
+	for scanner.Scan() {
+		e := scanner.TreeEntry()
+		name := path.Join(prefix, e.Name())
+		if fs.excluded(name, e) {
+			continue
+		}
+		switch e.Type {
+		case g.ObjectBlob:
+			if _, ok := blobs[e.Id.String()]; !ok {
+				blobs[e.Id.String()] = blobPath{name, e}
+			}
+		case g.ObjectTree:
+			sub, err := tree.SubTree(e.Name())
+			if err != nil {
+				return errors.Wrap(err, "Cannot get subtree.")
+			}
+			if err := fs.indexBlobs(blobs, sub, name); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.Wrap(scanner.Err(), "Cannot scan tree.")
+}
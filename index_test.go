@@ -0,0 +1,73 @@
+package ghfs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+)
+
+// A tree ten directories deep with 50 files in each of them
+func deepTree(tb testing.TB) (http.FileSystem, string) {
+	f := newFixture(tb)
+	dir := ""
+	for depth := 0; depth < 10; depth++ {
+		dir = path.Join(dir, fmt.Sprint("dir", depth))
+		for i := 0; i < 50; i++ {
+			f.write(path.Join(dir, fmt.Sprint("f", i)), fmt.Sprintf("%d-%d", depth, i))
+		}
+	}
+	return FromCommit(f.commit("Deep")), "/" + path.Join(dir, "f49")
+}
+
+func TestPathIndex(t *testing.T) {
+	hfs, deep := deepTree(t)
+	commit := hfs.(GitFileSystem).Commit()
+	for _, opt := range []Option{WithPathIndex(0), WithPathIndex(10)} {
+		hfs := FromCommit(commit, opt)
+		for name, want := range map[string]string{deep: "9-49", "/dir0/f3": "0-3"} {
+			f, err := hfs.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil || string(data) != want {
+				t.Errorf("%s: read %q, %v, want %q", name, data, err, want)
+			}
+		}
+		if _, err := hfs.Open("/dir0/nope"); !os.IsNotExist(err) {
+			t.Errorf("Open of a missing file = %v", err)
+		}
+		if names := readdirnames(t, hfs, "/dir0/dir1/dir2/dir3/dir4/dir5/dir6/dir7/dir8/dir9"); len(names) != 50 {
+			t.Errorf("Readdir of the deepest directory = %d entries", len(names))
+		}
+	}
+}
+
+// Open a file ten directories deep by walking the trees and through the
+// path index
+func BenchmarkOpenDeep(b *testing.B) {
+	hfs, deep := deepTree(b)
+	commit := hfs.(GitFileSystem).Commit()
+	for _, bench := range []struct {
+		name string
+		hfs  http.FileSystem
+	}{
+		{"tree", hfs},
+		{"index", FromCommit(commit, WithPathIndex(0))},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f, err := bench.hfs.Open(deep)
+				if err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+			}
+		})
+	}
+}
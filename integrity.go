@@ -0,0 +1,72 @@
+package ghfs
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Compute the Subresource Integrity value of the file at name, like
+// "sha384-...", for the integrity attribute of script and link tags.
+// Blobs are content addressed, so the value only changes with the object
+// id of the file
+func Integrity(fs http.FileSystem, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return "", &os.PathError{Op: "integrity", Path: name, Err: ErrIsDir}
+	}
+
+	h := sha512.New384()
+	if _, err := copyBuffer(h, f); err != nil {
+		return "", errors.Wrapf(err, "Cannot read %s.", name)
+	}
+	return "sha384-" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// Compute the Integrity of every regular file below dir whose name ends in
+// one of exts, e.g. ".js" and ".css", or of all files if exts is empty.
+// The result maps absolute paths of fs to their integrity value
+func IntegrityManifest(fs http.FileSystem, dir string, exts ...string) (map[string]string, error) {
+	manifest := map[string]string{}
+	err := Walk(fs, dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() || !hasExt(name, exts) {
+			return err
+		}
+		sri, err := Integrity(fs, name)
+		if err != nil {
+			return err
+		}
+		manifest[name] = sri
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func hasExt(name string, exts []string) bool {
+	if len(exts) == 0 {
+		return true
+	}
+	for _, ext := range exts {
+		if strings.EqualFold(filepath.Ext(name), ext) {
+			return true
+		}
+	}
+	return false
+}
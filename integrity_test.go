@@ -0,0 +1,61 @@
+package ghfs
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIntegrity(t *testing.T) {
+	files := map[string]string{
+		"app.js":          "console.log(1)",
+		"lib/style.CSS":   "body {}",
+		"lib/util.js":     blobContent(100 << 10),
+		"index.html":      "<html>",
+		"lib/link.js@":    "util.js",
+		"lib/sub/deep.js": "deep",
+	}
+	_, commit := newRepo(t, files)
+	hfs := FromCommit(commit)
+	sri := func(name string) string {
+		sum := sha512.Sum384([]byte(files[name]))
+		return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	got, err := Integrity(hfs, "/lib/util.js")
+	if err != nil || got != sri("lib/util.js") {
+		t.Errorf("Integrity of lib/util.js = %s, %v, want %s", got, err, sri("lib/util.js"))
+	}
+	if _, err := Integrity(hfs, "/lib"); err == nil {
+		t.Error("Integrity of a directory: no error")
+	}
+	if _, err := Integrity(hfs, "/nope.js"); !os.IsNotExist(err) {
+		t.Errorf("Integrity of a missing file: got %v, want not exist", err)
+	}
+
+	for _, test := range []struct {
+		dir  string
+		exts []string
+		want []string
+	}{
+		// Symlinks are skipped, extensions match regardless of case
+		{"/", []string{".js", ".css"}, []string{"app.js", "lib/style.CSS", "lib/util.js", "lib/sub/deep.js"}},
+		{"/lib", []string{".js"}, []string{"lib/util.js", "lib/sub/deep.js"}},
+		{"/", nil, []string{"app.js", "lib/style.CSS", "lib/util.js", "index.html", "lib/sub/deep.js"}},
+	} {
+		manifest, err := IntegrityManifest(hfs, test.dir, test.exts...)
+		if err != nil {
+			t.Errorf("IntegrityManifest(%s, %q): %v", test.dir, test.exts, err)
+			continue
+		}
+		want := map[string]string{}
+		for _, name := range test.want {
+			want["/"+name] = sri(name)
+		}
+		if !reflect.DeepEqual(manifest, want) {
+			t.Errorf("IntegrityManifest(%s, %q) = %v, want %v", test.dir, test.exts, manifest, want)
+		}
+	}
+}
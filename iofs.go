@@ -0,0 +1,231 @@
+package ghfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	g "github.com/gogits/git"
+)
+
+// Implement io/fs.FS on top of a http.FileSystem
+type iofs struct {
+	hfs http.FileSystem
+}
+
+// Serve a http.FileSystem, like the ones returned by FromCommit, as an
+// io/fs.FS
+func FS(hfs http.FileSystem) fs.FS {
+	return iofs{hfs}
+}
+
+func (f iofs) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		name = ""
+	}
+
+	file, err := f.hfs.Open("/" + name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, pathError("stat", name, err)
+	}
+	if fi.IsDir() {
+		return dirFile{file}, nil
+	}
+	return file, nil
+}
+
+// Wrap err in a *fs.PathError unless it already is one
+func pathError(op, name string, err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return &fs.PathError{Op: op, Path: name, Err: pe.Err}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Implement fs.ReadDirFile on a http.File directory
+type dirFile struct {
+	http.File
+}
+
+func (d dirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	fis, err := d.Readdir(count)
+	entries := make([]fs.DirEntry, len(fis))
+	for i, fi := range fis {
+		entries[i] = fs.FileInfoToDirEntry(fi)
+	}
+	if err == nil && count > 0 && len(entries) == 0 {
+		err = io.EOF
+	}
+	return entries, err
+}
+
+// Implement fs.ReadDirFS with a single scan of the directory. Entries are
+// sorted by name
+func (f iofs) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dir, ok := file.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrNotDir}
+	}
+	entries, err := dir.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, err
+}
+
+// Implement fs.ReadFileFS. Blobs of a git filesystem are read in one go
+// into a buffer of the blob's size
+func (f iofs) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	gfs, ok := f.hfs.(ghfs)
+	if !ok {
+		return f.readFile(name)
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrIsDir}
+	}
+
+	_, entry, err := gfs.lookup(name)
+	if err != nil {
+		return nil, pathError("readfile", name, gfs.mapError(err))
+	}
+	if entry.Type != g.ObjectBlob {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrIsDir}
+	}
+	if err := gfs.checkSize("readfile", name, entry); err != nil {
+		return nil, gfs.mapError(err)
+	}
+
+	rc, err := gfs.cache.Data(entry)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	defer rc.Close()
+
+	buf := make([]byte, entrySize(entry))
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return buf, nil
+}
+
+func (f iofs) readFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	if fi.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrIsDir}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, fi.Size()+bytes.MinRead))
+	if _, err := buf.ReadFrom(file); err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Implement fs.StatFS. For git filesystems only the tree entry is looked
+// up, no file is opened
+func (f iofs) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	gfs, ok := f.hfs.(ghfs)
+	if !ok || name == "." {
+		file, err := f.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return file.Stat()
+	}
+
+	real, entry, err := gfs.lookup(name)
+	if err != nil {
+		return nil, pathError("stat", name, gfs.mapError(err))
+	}
+	return gfs.fileInfo(real, entry), nil
+}
+
+// Implement fs.GlobFS. The pattern is expanded directory by directory, so
+// only directories matching the leading components are read. Invalid
+// patterns return filepath.ErrBadPattern
+func (f iofs) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, filepath.ErrBadPattern
+	}
+	return f.glob(pattern)
+}
+
+func (f iofs) glob(pattern string) ([]string, error) {
+	if !hasMeta(pattern) {
+		if _, err := f.Stat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := path.Split(pattern)
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" {
+		dir = "."
+	}
+
+	dirs := []string{dir}
+	if hasMeta(dir) {
+		var err error
+		if dirs, err = f.glob(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []string
+	for _, d := range dirs {
+		entries, err := f.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if ok, _ := path.Match(file, e.Name()); ok {
+				matches = append(matches, path.Join(d, e.Name()))
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
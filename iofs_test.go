@@ -0,0 +1,62 @@
+package ghfs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+var fixtureFiles = map[string]string{
+	"a.txt":          "hello world",
+	"dir/b.txt":      "bee",
+	"dir/sub/c.html": "<html></html>",
+	"dir/sub/d-e.md": "# d",
+	"x-y/z.txt":      "zzz",
+	"empty":          "",
+	"run.sh*":        "#!/bin/sh\necho hi\n",
+}
+
+func TestFSTest(t *testing.T) {
+	_, commit := newRepo(t, fixtureFiles)
+	fsys := FS(FromCommit(commit))
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.html", "dir/sub/d-e.md", "x-y/z.txt", "empty", "run.sh"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	files := map[string]string{"x/z.txt": "x"}
+	for name, content := range fixtureFiles {
+		files[name] = content
+	}
+	_, commit := newRepo(t, files)
+	fsys := FS(FromCommit(commit))
+
+	// Matches are sorted as a whole, "x-y/" sorts before "x/"
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.txt", []string{"a.txt"}},
+		{"*/*.txt", []string{"dir/b.txt", "x-y/z.txt", "x/z.txt"}},
+		{"dir/*/*", []string{"dir/sub/c.html", "dir/sub/d-e.md"}},
+		{"x*/z.txt", []string{"x-y/z.txt", "x/z.txt"}},
+		{"nope/*", nil},
+	}
+	for _, test := range tests {
+		got, err := fs.Glob(fsys, test.pattern)
+		if err != nil {
+			t.Errorf("Glob(%q): %v", test.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Glob(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+
+	if _, err := fs.Glob(fsys, "dir/[a"); err != filepath.ErrBadPattern {
+		t.Errorf("Glob of invalid pattern: got %v, want %v", err, filepath.ErrBadPattern)
+	}
+}
@@ -0,0 +1,72 @@
+package ghfs
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// An entry of a JSON directory listing
+type ListEntry struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	IsDir   bool        `json:"isDir"`
+	SHA     string      `json:"sha,omitempty"`
+}
+
+// List directories as a JSON array of ListEntry if requested with
+// "Accept: application/json" or the query "format=json"
+func WithJSONListings() HandlerOption {
+	return func(h *handler) {
+		h.json = true
+	}
+}
+
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(accept); err == nil && mt == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+func serveJSONListing(w http.ResponseWriter, fs http.FileSystem, name string) {
+	f, err := fs.Open(name)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]ListEntry, len(fis))
+	for i, fi := range fis {
+		entries[i] = ListEntry{
+			Name:    fi.Name(),
+			Size:    fi.Size(),
+			Mode:    fi.Mode(),
+			ModTime: fi.ModTime(),
+			IsDir:   fi.IsDir(),
+		}
+		if gfi, ok := fi.(GitFileInfo); ok {
+			entries[i].SHA = gfi.SHA()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
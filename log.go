@@ -0,0 +1,107 @@
+package ghfs
+
+import (
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// Return up to max commits that changed the file or directory at name,
+// most recent first. History is followed along first parents of the
+// served commit. Renamed blobs are followed if a blob with the same
+// content exists in the parent. max <= 0 returns all commits
+func (fs ghfs) Log(name string, max int) ([]*g.Commit, error) {
+	if fs.commit == nil {
+		return nil, ErrNoCommit
+	}
+	name, ok := cleanPath(name)
+	if !ok {
+		return nil, &os.PathError{Op: "log", Path: name, Err: os.ErrNotExist}
+	}
+	// Renamed blobs are searched in the served tree of the parent, to
+	// which the rules of WithAllow, WithDeny and WithHiddenPrefix apply
+	root, err := fs.commitPath("")
+	if err != nil {
+		return nil, err
+	}
+	name = path.Join(root, name)
+
+	commit := fs.commit
+	entry, err := commitEntry(commit, name)
+	if err != nil {
+		return nil, fs.mapError(err)
+	}
+	if entry == nil {
+		return nil, &os.PathError{Op: "log", Path: name, Err: os.ErrNotExist}
+	}
+
+	var ret []*g.Commit
+	for max <= 0 || len(ret) < max {
+		var parent *g.Commit
+		var pentry *g.TreeEntry
+		if commit.ParentCount() > 0 {
+			if parent, err = commit.Parent(0); err != nil {
+				return nil, errors.Wrap(err, "Cannot get parent commit.")
+			}
+		}
+		if parent != nil {
+			if pentry, err = commitEntry(parent, name); err != nil {
+				return nil, fs.mapError(err)
+			}
+			if pentry == nil && entry.Type == g.ObjectBlob {
+				// Best effort rename detection
+				var pname string
+				if pname, pentry, err = fs.findRenamed(parent, root, entry.Id.String()); err != nil {
+					return nil, fs.mapError(err)
+				}
+				if pentry != nil {
+					name = path.Join(root, pname)
+				}
+			}
+		}
+
+		if pentry == nil || pentry.Id != entry.Id {
+			ret = append(ret, commit)
+		}
+		if pentry == nil {
+			break
+		}
+		commit, entry = parent, pentry
+	}
+	return ret, nil
+}
+
+// Find the blob with object id sha below root of the tree of commit, like
+// OpenBlob does in the served tree. The path is relative to root
+func (fs ghfs) findRenamed(commit *g.Commit, root, sha string) (string, *g.TreeEntry, error) {
+	if root == "" {
+		return fs.findBlob(&commit.Tree, "", sha)
+	}
+	tree, err := commit.Tree.SubTree(root)
+	switch {
+	case err == g.ErrNotExist:
+		return "", nil, nil
+	case err != nil:
+		return "", nil, errors.Wrap(err, "Cannot get subtree.")
+	}
+	return fs.findBlob(tree, "", sha)
+}
+
+// Return the entry at name of the tree of commit, or nil if it doesn't
+// exist. name "" is the root tree
+func commitEntry(commit *g.Commit, name string) (*g.TreeEntry, error) {
+	if name == "" {
+		return &g.TreeEntry{Id: commit.Tree.Id, Type: g.ObjectTree}, nil
+	}
+	entry, err := commit.GetTreeEntryByPath(name)
+	switch {
+	case err == g.ErrNotExist:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "Cannot get entry.")
+	}
+	return entry, nil
+}
@@ -0,0 +1,194 @@
+package ghfs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// Return the ids of commits
+func commitIds(commits []*g.Commit) []string {
+	ids := []string{}
+	for _, c := range commits {
+		ids = append(ids, c.Id.String())
+	}
+	return ids
+}
+
+func TestLog(t *testing.T) {
+	f := newFixture(t)
+	f.write("old", "v1")
+	f.write("o", "x")
+	c1 := f.commit("Add old and o").Id.String()
+	f.write("old", "v2")
+	c2 := f.commit("Change old").Id.String()
+	f.remove("old")
+	f.write("new", "v2")
+	c3 := f.commit("Rename old to new").Id.String()
+	f.write("o", "y")
+	c4 := f.commit("Change o").Id.String()
+	f.write("new", "v3")
+	commit := f.commit("Change new")
+	c5 := commit.Id.String()
+
+	hfs := FromCommit(commit).(GitFileSystem)
+	tests := []struct {
+		name string
+		max  int
+		want []string
+	}{
+		// Followed through the rename in c3
+		{"/new", 0, []string{c5, c2, c1}},
+		{"/new", 2, []string{c5, c2}},
+		{"/o", 0, []string{c4, c1}},
+		{"/", 0, []string{c5, c4, c3, c2, c1}},
+	}
+	for _, test := range tests {
+		commits, err := hfs.Log(test.name, test.max)
+		if err != nil {
+			t.Errorf("Log(%q, %d): %v", test.name, test.max, err)
+			continue
+		}
+		if got := commitIds(commits); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Log(%q, %d) = %q, want %q", test.name, test.max, got, test.want)
+		}
+	}
+}
+
+func TestLogSubtree(t *testing.T) {
+	f := newFixture(t)
+	f.write("docs/a", "v1")
+	f.write("one/x", "x")
+	f.write("two/x", "x")
+	c1 := f.commit("Add docs").Id.String()
+	f.write("docs/a", "v2")
+	c2 := f.commit("Change docs/a").Id.String()
+	f.write("b", "b")
+	commit := f.commit("Add b")
+
+	sub := func(name string) *g.Tree {
+		tree, err := commit.Tree.SubTree(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+
+	docs := FromCommit(commit, WithSubtree(sub("docs"))).(GitFileSystem)
+	for i := 0; i < 2; i++ {
+		commits, err := docs.Log("/a", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := commitIds(commits), []string{c2, c1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Log of docs/a = %q, want %q", got, want)
+		}
+	}
+	blame, err := docs.Blame("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blame) != 1 || blame[0].SHA != c2 {
+		t.Errorf("Blame of docs/a = %+v, want line of %s", blame, c2)
+	}
+
+	// one and two have the same content and thus the same tree id
+	one := FromCommit(commit, WithSubtree(sub("one"))).(GitFileSystem)
+	if _, err := one.Log("/x", 0); errors.Cause(err) != ErrAmbiguousSubtree {
+		t.Errorf("Log of one/x: got %v, want %v", err, ErrAmbiguousSubtree)
+	}
+	if _, err := one.Blame("/x"); errors.Cause(err) != ErrAmbiguousSubtree {
+		t.Errorf("Blame of one/x: got %v, want %v", err, ErrAmbiguousSubtree)
+	}
+
+	// A tree of another commit
+	f.write("docs/a", "v3")
+	other := f.commit("Change docs/a again")
+	tree, err := other.Tree.SubTree("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromCommit(commit, WithSubtree(tree)).(GitFileSystem).Log("/a", 0); errors.Cause(err) != ErrNotSubtree {
+		t.Errorf("Log of foreign tree: got %v, want %v", err, ErrNotSubtree)
+	}
+}
+
+func TestBlame(t *testing.T) {
+	f := newFixture(t)
+	f.write("a", "one\ntwo\nthree\n")
+	c1 := f.commit("Add a").Id.String()
+	f.write("a", "one\n2\nthree\nfour\n")
+	c2 := f.commit("Change two, add four").Id.String()
+	f.write("b", "b")
+	f.commit("Add b")
+	f.write("a", "zero\none\n2\nthree\nfour")
+	commit := f.commit("Add zero, drop the last newline")
+	c4 := commit.Id.String()
+
+	hfs := FromCommit(commit).(GitFileSystem)
+	want := []struct{ sha, line string }{
+		{c4, "zero"},
+		{c1, "one"},
+		{c2, "2"},
+		{c1, "three"},
+		// Changed from "four\n"
+		{c4, "four"},
+	}
+	for i := 0; i < 2; i++ {
+		lines, err := hfs.Blame("/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != len(want) {
+			t.Fatalf("Blame of a = %+v, want %d lines", lines, len(want))
+		}
+		for n, l := range lines {
+			if l.SHA != want[n].sha || l.Line != want[n].line {
+				t.Errorf("line %d = %s %q, want %s %q", n, l.SHA, l.Line, want[n].sha, want[n].line)
+			}
+			if l.Author == "" || l.When.IsZero() {
+				t.Errorf("line %d: no author in %+v", n, l)
+			}
+		}
+		// Changing the result doesn't change the cache
+		lines[0].Line = "changed"
+	}
+
+	if _, err := hfs.Blame("/nope"); !os.IsNotExist(err) {
+		t.Errorf("Blame of missing file: got %v, want not exist", err)
+	}
+}
+
+func TestLogRenameSubtree(t *testing.T) {
+	f := newFixture(t)
+	f.write("other/a", "a")
+	f.write("docs/secret/b", "b")
+	f.commit("Add other/a and docs/secret/b")
+	f.remove("other/a")
+	f.remove("docs/secret/b")
+	f.write("docs/a", "a")
+	f.write("docs/b", "b")
+	commit := f.commit("Move a and b to docs")
+	c2 := commit.Id.String()
+
+	docs, err := commit.Tree.SubTree("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rules apply relative to docs: other/a is not served and
+	// secret/b is denied, so neither is a rename of the served files
+	hfs := FromCommit(commit, WithSubtree(docs), WithDeny("secret/b")).(GitFileSystem)
+	for _, name := range []string{"/a", "/b"} {
+		commits, err := hfs.Log(name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := commitIds(commits), []string{c2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Log of %s = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package ghfs
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Header set on truncated listings to the number of entries of the
+// directory
+const ListingTotalHeader = "X-Listing-Total"
+
+// List at most n entries of a directory, the first ones by name, in HTML
+// and JSON listings. Truncated listings get the ListingTotalHeader, so
+// clients can show how many entries were left out
+func WithMaxListEntries(n int) HandlerOption {
+	return func(h *handler) {
+		h.maxEntries = n
+	}
+}
+
+// Truncate listings of all entries to max, reporting the total in header
+type limitfs struct {
+	http.FileSystem
+	max    int
+	header http.Header
+}
+
+func (l limitfs) Open(name string) (http.File, error) {
+	f, err := l.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.IsDir() {
+		return f, nil
+	}
+	return limitDir{f, l}, nil
+}
+
+type limitDir struct {
+	http.File
+	l limitfs
+}
+
+// Readdir with count > 0 pages as usual, only complete listings are
+// truncated
+func (d limitDir) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := d.File.Readdir(count)
+	if count > 0 || err != nil || len(fis) <= d.l.max {
+		return fis, err
+	}
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Name() < fis[j].Name()
+	})
+	d.l.header.Set(ListingTotalHeader, strconv.Itoa(len(fis)))
+	return fis[:d.l.max], nil
+}
@@ -0,0 +1,145 @@
+package ghfs
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Counters of all filesystems, caches and handlers of the package. They
+// are only served by MetricsHandler, not published with expvar, so they do
+// not show up on /debug/vars of servers that import expvar
+var (
+	cacheHits    atomic.Int64
+	cacheMisses  atomic.Int64
+	bytesServed  atomic.Int64
+	requests     atomic.Int64
+	openErrors   [len(openErrorKinds)]atomic.Int64
+	latencies    [len(latencyLimit) + 1]atomic.Int64
+	latencyLimit = [...]time.Duration{
+		time.Millisecond,
+		10 * time.Millisecond,
+		100 * time.Millisecond,
+		time.Second,
+		10 * time.Second,
+	}
+)
+
+const (
+	notExistError = iota
+	permissionError
+	tooLargeError
+	otherError
+)
+
+var openErrorKinds = [...]string{
+	notExistError:   "not_exist",
+	permissionError: "permission",
+	tooLargeError:   "too_large",
+	otherError:      "other",
+}
+
+// Serve the metrics of the package as JSON object. Request latencies of
+// Handler are counted in buckets keyed by their upper bound in seconds.
+// Open errors include the lookups Handler does for index files and
+// precompressed siblings
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(appendMetrics(nil))
+	})
+}
+
+// Append the metrics as JSON object, with keys sorted like expvar does
+func appendMetrics(buf []byte) []byte {
+	buf = append(buf, `{"bytes_served": `...)
+	buf = strconv.AppendInt(buf, bytesServed.Load(), 10)
+	buf = append(buf, `, "cache_hits": `...)
+	buf = strconv.AppendInt(buf, cacheHits.Load(), 10)
+	buf = append(buf, `, "cache_misses": `...)
+	buf = strconv.AppendInt(buf, cacheMisses.Load(), 10)
+
+	buf = append(buf, `, "open_errors": {`...)
+	for i, kind := range openErrorKinds {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = strconv.AppendQuote(buf, kind)
+		buf = append(buf, ": "...)
+		buf = strconv.AppendInt(buf, openErrors[i].Load(), 10)
+	}
+
+	buf = append(buf, `}, "request_seconds": {`...)
+	for i := range latencies {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = strconv.AppendQuote(buf, latencyKey(i))
+		buf = append(buf, ": "...)
+		buf = strconv.AppendInt(buf, latencies[i].Load(), 10)
+	}
+
+	buf = append(buf, `}, "requests": `...)
+	buf = strconv.AppendInt(buf, requests.Load(), 10)
+	return append(buf, "}\n"...)
+}
+
+// Return the key of the i-th latency bucket
+func latencyKey(i int) string {
+	if i == len(latencyLimit) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(latencyLimit[i].Seconds(), 'g', -1, 64)
+}
+
+// Count a failed Open by the kind of error
+func countOpenError(err error) {
+	switch {
+	case err == nil:
+		return
+	case os.IsNotExist(err):
+		openErrors[notExistError].Add(1)
+	case os.IsPermission(err):
+		openErrors[permissionError].Add(1)
+	case tooLarge(err):
+		openErrors[tooLargeError].Add(1)
+	default:
+		openErrors[otherError].Add(1)
+	}
+}
+
+func countRequest(d time.Duration) {
+	requests.Add(1)
+	for i, limit := range latencyLimit {
+		if d <= limit {
+			latencies[i].Add(1)
+			return
+		}
+	}
+	latencies[len(latencyLimit)].Add(1)
+}
+
+// Count the bytes written to a response
+type countingWriter struct {
+	http.ResponseWriter
+}
+
+func (w countingWriter) Write(buf []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(buf)
+	bytesServed.Add(int64(n))
+	return n, err
+}
+
+// Keep the io.ReaderFrom of the wrapped writer, which http.ServeContent
+// copies through, and fall back to a pooled buffer
+func (w countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := copyBuffer(w.ResponseWriter, r)
+	bytesServed.Add(n)
+	return n, err
+}
+func (w countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,56 @@
+package ghfs
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a": "hello"})
+	h := Handler(FromCommit(commit, WithBlobCache(NewBlobCache(100))))
+
+	before := readMetrics(t)
+	for _, p := range []string{"/a", "/a", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+	after := readMetrics(t)
+
+	delta := func(key string) float64 {
+		return after[key].(float64) - before[key].(float64)
+	}
+	if d := delta("requests"); d != 3 {
+		t.Errorf("requests: got %v more, want 3", d)
+	}
+	if d := delta("bytes_served"); d < 10 {
+		t.Errorf("bytes_served: got %v more, want at least 10", d)
+	}
+	if d := delta("cache_hits"); d != 1 {
+		t.Errorf("cache_hits: got %v more, want 1", d)
+	}
+	notExist := func(m map[string]interface{}) float64 {
+		return m["open_errors"].(map[string]interface{})["not_exist"].(float64)
+	}
+	if d := notExist(after) - notExist(before); d < 1 {
+		t.Errorf("open_errors.not_exist: got %v more, want at least 1", d)
+	}
+	if _, ok := after["request_seconds"].(map[string]interface{})["+Inf"]; !ok {
+		t.Errorf("request_seconds: missing +Inf bucket")
+	}
+
+	if expvar.Get("ghfs") != nil {
+		t.Error("metrics published with expvar")
+	}
+}
+
+func readMetrics(t *testing.T) map[string]interface{} {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	var m map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	return m
+}
@@ -0,0 +1,54 @@
+package ghfs
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Serve fs with Handler below prefix, e.g. "/site/", like http.StripPrefix
+// would. Requests for prefix without trailing slash are redirected to it,
+// so relative links of listings resolve below prefix, and absolute
+// redirects of the handler get prefix prepended. Other paths are not found
+func MountAt(prefix string, fs http.FileSystem, opts ...HandlerOption) http.Handler {
+	h := Handler(fs, opts...)
+	prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	if prefix == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix {
+			localRedirect(w, r, path.Base(prefix)+"/")
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		u := *r.URL
+		u.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		u.RawPath = ""
+		r2 := *r
+		r2.URL = &u
+		h.ServeHTTP(mountWriter{w, prefix}, &r2)
+	})
+}
+
+// Prepend prefix to absolute Location headers
+type mountWriter struct {
+	http.ResponseWriter
+	prefix string
+}
+
+func (w mountWriter) WriteHeader(status int) {
+	loc := w.Header().Get("Location")
+	if strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+		w.Header().Set("Location", w.prefix+loc)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+func (w mountWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
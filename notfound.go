@@ -0,0 +1,72 @@
+package ghfs
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// Serve the file at name with 404 Not Found for paths that don't exist,
+// like 404.html of GitHub Pages. If name doesn't exist either, the plain
+// response of http.NotFound is sent
+func WithNotFoundFile(name string) HandlerOption {
+	return func(h *handler) {
+		h.notFound = path.Join("/", name)
+	}
+}
+
+// Serve the file at name with 200 OK for paths that don't exist, so the
+// router of a single page application can handle them. Paths with a file
+// extension other than .html, like missing scripts or stylesheets, are
+// still not found
+func WithSPAFallback(name string) HandlerOption {
+	return func(h *handler) {
+		h.fallback = path.Join("/", name)
+	}
+}
+
+func (h *handler) serveNotFound(w http.ResponseWriter, r *http.Request, fs http.FileSystem) {
+	if h.fallback != "" && isRoute(r.URL.Path) && h.serveFile(w, r, fs, h.fallback) {
+		return
+	}
+	if h.notFound == "" || !h.serveStatus(w, r, fs, h.notFound, http.StatusNotFound) {
+		http.NotFound(w, r)
+	}
+}
+
+// Serve the regular file at name with status instead of 200 OK. Unlike
+// serveFile, range and conditional requests are not handled. Reports
+// false without writing a response if it doesn't exist or is a directory
+func (h *handler) serveStatus(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string, status int) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+
+	if ct, ok := h.responseType(r, fs, name); ok {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		copyBuffer(w, f)
+	}
+	return true
+}
+
+// Report whether the request path looks like a route of a single page
+// application rather than an asset
+func isRoute(name string) bool {
+	switch path.Ext(path.Base(name)) {
+	case "", ".html", ".htm":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,454 @@
+package ghfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+var (
+	// Returned when an object id is not a hex string of valid length
+	ErrInvalidId = errors.New("Invalid object id")
+	// Returned when an object id does not match any object
+	ErrNoSuchObject = errors.New("No such object")
+	// Returned when an abbreviated commit id matches more than one commit
+	ErrAmbiguousId = errors.New("Ambiguous object id")
+)
+
+const (
+	minIdLen  = 4
+	fullIdLen = 40
+)
+
+var packIdxMagic = []byte{0377, 't', 'O', 'c'}
+
+// Return the git directory of a repository, which is the .git
+// subdirectory for repositories with a working tree
+func gitDir(repo *g.Repository) string {
+	dotgit := filepath.Join(repo.Path, ".git")
+	if fi, err := os.Stat(dotgit); err == nil && fi.IsDir() {
+		return dotgit
+	}
+	return repo.Path
+}
+
+// Expand an abbreviated commit id to a full 40 character id by looking
+// at the loose objects and pack indexes of the repository. Like git does
+// for ids naming a commit, only commits are candidates: an id is not
+// ambiguous if it also is the prefix of trees or blobs. Ids of trees and
+// blobs return ErrNotCommit
+func expandId(repo *g.Repository, id string) (string, error) {
+	id = strings.ToLower(id)
+	if len(id) < minIdLen || len(id) > fullIdLen || strings.Trim(id, "0123456789abcdef") != "" {
+		return "", errors.Wrap(ErrInvalidId, id)
+	}
+
+	matches, err := findObjects(repo, id)
+	if err != nil {
+		return "", err
+	}
+	var commits []string
+	for full, loc := range matches {
+		typ, _, err := readObjectAt(repo, full, loc, true)
+		if err != nil {
+			return "", errors.Wrapf(err, "Cannot read type of %s.", full)
+		}
+		if typ == g.ObjectCommit {
+			commits = append(commits, full)
+		}
+	}
+
+	switch {
+	case len(commits) == 1:
+		return commits[0], nil
+	case len(commits) > 1:
+		return "", errors.Wrap(ErrAmbiguousId, id)
+	case len(matches) > 0:
+		return "", errors.Wrap(ErrNotCommit, id)
+	}
+	return "", errors.Wrap(ErrNoSuchObject, id)
+}
+
+// Where an object is stored: a loose object file, or an offset in a pack
+type objectLoc struct {
+	// Path of the pack, empty for loose objects
+	pack   string
+	offset int64
+}
+
+// Find the objects whose id starts with prefix
+func findObjects(repo *g.Repository, prefix string) (map[string]objectLoc, error) {
+	matches := map[string]objectLoc{}
+	if err := matchLoose(repo, prefix, matches); err != nil {
+		return nil, err
+	}
+	idxs, err := filepath.Glob(filepath.Join(gitDir(repo), "objects", "pack", "*.idx"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot list pack indexes.")
+	}
+	for _, idx := range idxs {
+		if err := matchPackIdx(idx, prefix, matches); err != nil {
+			return nil, errors.Wrapf(err, "Cannot read pack index %s.", idx)
+		}
+	}
+	return matches, nil
+}
+
+func matchLoose(repo *g.Repository, id string, matches map[string]objectLoc) error {
+	dir, err := os.Open(filepath.Join(gitDir(repo), "objects", id[:2]))
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return errors.Wrap(err, "Cannot open object directory.")
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return errors.Wrap(err, "Cannot read object directory.")
+	}
+	for _, name := range names {
+		full := id[:2] + name
+		if len(full) == fullIdLen && strings.HasPrefix(full, id) {
+			matches[full] = objectLoc{}
+		}
+	}
+	return nil
+}
+
+// Scan the ids of a version 1 or 2 pack index for a prefix. Only the
+// fanout bucket of the first id byte is read.
+func matchPackIdx(path string, id string, matches map[string]objectLoc) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return err
+	}
+
+	v2 := bytes.Equal(header[:4], packIdxMagic)
+	var fanoutOff, idsOff, stride, idOff int64
+	if v2 {
+		if v := binary.BigEndian.Uint32(header[4:]); v != 2 {
+			return errors.Errorf("Unsupported pack index version %d", v)
+		}
+		fanoutOff, idsOff, stride, idOff = 8, 8+256*4, 20, 0
+	} else {
+		fanoutOff, idsOff, stride, idOff = 0, 256*4, 24, 4
+	}
+
+	fanout := make([]uint32, 256)
+	if _, err := f.Seek(fanoutOff, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Read(f, binary.BigEndian, fanout); err != nil {
+		return err
+	}
+
+	first, err := hex.DecodeString(id[:2])
+	if err != nil {
+		return err
+	}
+	var lo uint32
+	if first[0] > 0 {
+		lo = fanout[first[0]-1]
+	}
+	hi := fanout[first[0]]
+	if hi <= lo {
+		return nil
+	}
+
+	buf := make([]byte, int64(hi-lo)*stride)
+	if _, err := f.ReadAt(buf, idsOff+int64(lo)*stride); err != nil {
+		return err
+	}
+	pack := strings.TrimSuffix(path, ".idx") + ".pack"
+	for i := int64(0); i < int64(hi-lo); i++ {
+		full := hex.EncodeToString(buf[i*stride+idOff : i*stride+idOff+20])
+		if !strings.HasPrefix(full, id) {
+			continue
+		}
+		loc := objectLoc{pack: pack}
+		if v2 {
+			loc.offset, err = packIdxOffset(f, idsOff, int64(fanout[255]), int64(lo)+i)
+			if err != nil {
+				return err
+			}
+		} else {
+			loc.offset = int64(binary.BigEndian.Uint32(buf[i*stride:]))
+		}
+		matches[full] = loc
+	}
+	return nil
+}
+
+// Read the pack offset of the n-th object of a version 2 pack index with
+// count objects. The ids are followed by the CRCs, the 31 bit offsets and
+// the 64 bit offsets the large ones refer to
+func packIdxOffset(f *os.File, idsOff, count, n int64) (int64, error) {
+	buf := make([]byte, 8)
+	offsetsOff := idsOff + count*(20+4)
+	if _, err := f.ReadAt(buf[:4], offsetsOff+n*4); err != nil {
+		return 0, err
+	}
+	off := binary.BigEndian.Uint32(buf)
+	if off&0x80000000 == 0 {
+		return int64(off), nil
+	}
+	if _, err := f.ReadAt(buf, offsetsOff+count*4+int64(off&0x7fffffff)*8); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(buf)), nil
+}
+
+// Types of pack entries. Deltas have the type of their base object
+var packTypes = map[byte]g.ObjectType{
+	1: g.ObjectCommit,
+	2: g.ObjectTree,
+	3: g.ObjectBlob,
+	4: g.ObjectTag,
+}
+
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var errCorruptObject = errors.New("Corrupt object")
+
+// Read the type and content of the object with the full id. With
+// typeOnly, content is not read and nil
+func readObject(repo *g.Repository, id string, typeOnly bool) (g.ObjectType, []byte, error) {
+	matches, err := findObjects(repo, id)
+	if err != nil {
+		return "", nil, err
+	}
+	loc, ok := matches[id]
+	if !ok {
+		return "", nil, errors.Wrap(ErrNoSuchObject, id)
+	}
+	return readObjectAt(repo, id, loc, typeOnly)
+}
+
+func readObjectAt(repo *g.Repository, id string, loc objectLoc, typeOnly bool) (g.ObjectType, []byte, error) {
+	if loc.pack != "" {
+		f, err := os.Open(loc.pack)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "Cannot open pack.")
+		}
+		defer f.Close()
+		return readPacked(repo, f, loc.offset, typeOnly)
+	}
+
+	f, err := os.Open(filepath.Join(gitDir(repo), "objects", id[:2], id[2:]))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Cannot open object.")
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Cannot decompress object.")
+	}
+	r := bufio.NewReader(zr)
+	header, err := r.ReadString(0)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Cannot read object header.")
+	}
+	typ, size, ok := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	n, err := strconv.ParseInt(size, 10, 64)
+	if !ok || err != nil {
+		return "", nil, errors.Wrap(errCorruptObject, id)
+	}
+	if typeOnly {
+		return g.ObjectType(typ), nil, nil
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", nil, errors.Wrap(err, "Cannot read object.")
+	}
+	return g.ObjectType(typ), data, nil
+}
+
+// Read the pack entry at offset, resolving deltas against their base
+func readPacked(repo *g.Repository, f *os.File, offset int64, typeOnly bool) (g.ObjectType, []byte, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Cannot read pack entry.")
+	}
+	kind := c >> 4 & 7
+	size := int64(c & 15)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil {
+			return "", nil, errors.Wrap(err, "Cannot read pack entry.")
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	var typ g.ObjectType
+	var base []byte
+	switch kind {
+	case packOfsDelta:
+		// Big endian base 128, adding one for every continued byte
+		c, err := r.ReadByte()
+		rel := int64(c & 0x7f)
+		for err == nil && c&0x80 != 0 {
+			c, err = r.ReadByte()
+			rel = (rel+1)<<7 | int64(c&0x7f)
+		}
+		if err != nil {
+			return "", nil, errors.Wrap(err, "Cannot read delta base.")
+		}
+		if rel <= 0 || rel > offset {
+			return "", nil, errCorruptObject
+		}
+		typ, base, err = readPacked(repo, f, offset-rel, typeOnly)
+		if err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		id := make([]byte, 20)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return "", nil, errors.Wrap(err, "Cannot read delta base.")
+		}
+		typ, base, err = readObject(repo, hex.EncodeToString(id), typeOnly)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		var ok bool
+		if typ, ok = packTypes[kind]; !ok {
+			return "", nil, errCorruptObject
+		}
+	}
+	if typeOnly {
+		return typ, nil, nil
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Cannot decompress pack entry.")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return "", nil, errors.Wrap(err, "Cannot read pack entry.")
+	}
+	if kind == packOfsDelta || kind == packRefDelta {
+		data, err = applyDelta(base, data)
+	}
+	return typ, data, err
+}
+
+// Build an object from the base object and a delta, which starts with
+// the sizes of both, followed by instructions to copy ranges of the base
+// or to insert new data
+func applyDelta(base, delta []byte) ([]byte, error) {
+	varint := func() int64 {
+		var n int64
+		for shift := uint(0); len(delta) > 0; shift += 7 {
+			c := delta[0]
+			delta = delta[1:]
+			n |= int64(c&0x7f) << shift
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		return n
+	}
+	if varint() != int64(len(base)) {
+		return nil, errCorruptObject
+	}
+	size := varint()
+	out := make([]byte, 0, size)
+
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Copy, the bits of op tell which offset and size bytes follow
+			var off, n int64
+			for i := uint(0); i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errCorruptObject
+				}
+				if i < 4 {
+					off |= int64(delta[0]) << (8 * i)
+				} else {
+					n |= int64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if off+n > int64(len(base)) {
+				return nil, errCorruptObject
+			}
+			out = append(out, base[off:off+n]...)
+		case op != 0:
+			// Insert the next op bytes
+			if int(op) > len(delta) {
+				return nil, errCorruptObject
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errCorruptObject
+		}
+	}
+	if int64(len(out)) != size {
+		return nil, errCorruptObject
+	}
+	return out, nil
+}
+
+// Return the type and id of the object the annotated tag with the
+// given id points to
+func peelTag(repo *g.Repository, id string) (g.ObjectType, string, error) {
+	typ, data, err := readObject(repo, id, false)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Cannot read tag.")
+	}
+	if typ != g.ObjectTag {
+		return "", "", errors.Wrapf(errCorruptObject, "%s is a %s, not a tag", id, typ)
+	}
+
+	var target, targetType string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			// End of the header, the message follows
+			break
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			target = value
+		case "type":
+			targetType = value
+		}
+	}
+	if len(target) != fullIdLen || targetType == "" {
+		return "", "", errors.Wrapf(errCorruptObject, "Tag %s", id)
+	}
+	return g.ObjectType(targetType), target, nil
+}
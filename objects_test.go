@@ -0,0 +1,146 @@
+package ghfs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// Compare readObject to git cat-file for every object of the repository
+func testReadObjects(t *testing.T, f *fixture) {
+	t.Helper()
+	repo := f.repo()
+	for _, line := range strings.Split(f.git("cat-file", "--batch-all-objects", "--batch-check"), "\n") {
+		fields := strings.Fields(line)
+		id, want := fields[0], g.ObjectType(fields[1])
+
+		typ, _, err := readObject(repo, id, true)
+		if err != nil || typ != want {
+			t.Errorf("type of %s: got %q, %v, want %q", id, typ, err, want)
+		}
+		typ, data, err := readObject(repo, id, false)
+		if err != nil || typ != want {
+			t.Errorf("%s: got %q, %v, want %q", id, typ, err, want)
+			continue
+		}
+		if content := f.gitBytes("cat-file", string(want), id); !bytes.Equal(data, content) {
+			t.Errorf("content of %s %s differs from git cat-file", want, id)
+		}
+	}
+}
+
+func TestReadObject(t *testing.T) {
+	f := newFixture(t)
+	// Similar versions of a file, which end up as deltas once packed
+	var content strings.Builder
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 1000; j++ {
+			content.WriteString("line of the file\n")
+		}
+		f.write("big.txt", content.String())
+		f.write("small.txt", strings.Repeat("x", i))
+		f.commit("Version")
+	}
+	f.git("tag", "-a", "-m", "Tag", "v1")
+
+	t.Run("loose", func(t *testing.T) {
+		testReadObjects(t, f)
+	})
+	f.git("gc", "-q", "--aggressive")
+	t.Run("packed", func(t *testing.T) {
+		testReadObjects(t, f)
+	})
+
+	if _, _, err := readObject(f.repo(), strings.Repeat("0", fullIdLen), false); errors.Cause(err) != ErrNoSuchObject {
+		t.Errorf("missing object: got %v, want %v", err, ErrNoSuchObject)
+	}
+}
+
+// Return the id git assigns to an object
+func objectId(typ g.ObjectType, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", typ, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Return the content of a blob with an id starting with prefix
+func blobWithPrefix(prefix string) []byte {
+	for i := 0; ; i++ {
+		data := []byte(strconv.Itoa(i))
+		if strings.HasPrefix(objectId(g.ObjectBlob, data), prefix) {
+			return data
+		}
+	}
+}
+
+// Return two commits of tree with ids sharing the first minIdLen digits
+func commitsWithSamePrefix(tree string) ([]byte, []byte) {
+	seen := map[string][]byte{}
+	for i := 0; ; i++ {
+		data := []byte(fmt.Sprintf("tree %s\nauthor ghfs <ghfs@example.com> 0 +0000\ncommitter ghfs <ghfs@example.com> 0 +0000\n\n%d\n", tree, i))
+		prefix := objectId(g.ObjectCommit, data)[:minIdLen]
+		if other, ok := seen[prefix]; ok {
+			return other, data
+		}
+		seen[prefix] = data
+	}
+}
+
+func TestExpandId(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"a": "a"})
+	id := commit.Id.String()
+	tree := f.git("rev-parse", "HEAD^{tree}")
+	blob := f.git("rev-parse", "HEAD:a")
+
+	// A blob sharing the abbreviated id of the commit
+	shadow := f.writeObject(g.ObjectBlob, blobWithPrefix(id[:minIdLen]))
+	// Two commits sharing an abbreviated id
+	c1, c2 := commitsWithSamePrefix(tree)
+	ambiguous := f.writeObject(g.ObjectCommit, c1)
+	f.writeObject(g.ObjectCommit, c2)
+
+	tests := []struct {
+		id   string
+		want string
+		err  error
+	}{
+		{id, id, nil},
+		{strings.ToUpper(id[:7]), id, nil},
+		{id[:minIdLen], id, nil},
+		{tree, "", ErrNotCommit},
+		{blob[:8], "", ErrNotCommit},
+		{shadow, "", ErrNotCommit},
+		{ambiguous[:minIdLen], "", ErrAmbiguousId},
+		{ambiguous, ambiguous, nil},
+		{strings.Repeat("0", fullIdLen), "", ErrNoSuchObject},
+		{id[:minIdLen-1], "", ErrInvalidId},
+		{id + "0", "", ErrInvalidId},
+		{"xyz123", "", ErrInvalidId},
+	}
+	test := func(t *testing.T) {
+		repo := f.repo()
+		for _, test := range tests {
+			got, err := expandId(repo, test.id)
+			if got != test.want || errors.Cause(err) != test.err {
+				t.Errorf("expandId(%q) = %q, %v, want %q, %v", test.id, got, err, test.want, test.err)
+			}
+		}
+		if _, err := FromHash(repo, tree); errors.Cause(err) != ErrNotCommit {
+			t.Errorf("FromHash of tree: got %v, want %v", err, ErrNotCommit)
+		}
+	}
+	t.Run("loose", test)
+	// Keep the unreferenced objects
+	f.git("repack", "-a", "-d", "-k", "-q")
+	f.git("prune-packed")
+	t.Run("packed", test)
+}
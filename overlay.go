@@ -0,0 +1,138 @@
+package ghfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+)
+
+type overlay struct {
+	upper http.FileSystem
+	lower http.FileSystem
+}
+
+// Serve paths from upper if they exist there and from lower otherwise.
+// Directories that exist in both list the union of their entries, with
+// the entries of upper taking precedence. Their subdirectories are merged
+// the same way when opened, while a file of upper hides a directory of
+// lower at the same path. A feature branch can be previewed on top of its
+// base:
+//
+//	fs := ghfs.Overlay(ghfs.FromCommit(feature), ghfs.FromCommit(base))
+func Overlay(upper, lower http.FileSystem) http.FileSystem {
+	return overlay{upper: upper, lower: lower}
+}
+
+func (o overlay) Open(name string) (http.File, error) {
+	return o.open(o.upper, o.lower, name)
+}
+func (o overlay) OpenContext(ctx context.Context, name string) (http.File, error) {
+	return o.open(WithContext(ctx, o.upper), WithContext(ctx, o.lower), name)
+}
+func (o overlay) open(upper, lower http.FileSystem, name string) (http.File, error) {
+	f, err := upper.Open(name)
+	if os.IsNotExist(err) {
+		if shadowed(upper, name) {
+			return nil, err
+		}
+		return lower.Open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return f, nil
+	}
+
+	l, err := lower.Open(name)
+	if err != nil {
+		// Nothing to merge
+		return f, nil
+	}
+	if lfi, err := l.Stat(); err != nil || !lfi.IsDir() {
+		l.Close()
+		return f, nil
+	}
+	return &overlayDir{File: f, lower: l}, nil
+}
+
+// Report whether the closest parent of name that exists in fs is a file,
+// which hides the directory of the same name in the lower filesystem
+func shadowed(fs http.FileSystem, name string) bool {
+	for dir := path.Dir(path.Clean("/" + name)); dir != "/"; dir = path.Dir(dir) {
+		if fi, ok := stat(fs, dir); ok {
+			return !fi.IsDir()
+		}
+	}
+	return false
+}
+
+// Readdir lists entries sorted lexicographically by name
+type overlayDir struct {
+	http.File
+	lower   http.File
+	entries []os.FileInfo
+	pos     int
+}
+
+func (d *overlayDir) Close() error {
+	err := d.File.Close()
+	if lerr := d.lower.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
+func (d *overlayDir) Readdir(count int) ([]os.FileInfo, error) {
+	if d.entries == nil {
+		if err := d.readEntries(); err != nil {
+			return nil, err
+		}
+	}
+
+	n := len(d.entries) - d.pos
+	if count > 0 && count < n {
+		n = count
+	}
+	ret := append([]os.FileInfo{}, d.entries[d.pos:d.pos+n]...)
+	d.pos += n
+	if count > 0 && n == 0 {
+		return ret, io.EOF
+	}
+	return ret, nil
+}
+func (d *overlayDir) readEntries() error {
+	upper, err := d.File.Readdir(0)
+	if err != nil {
+		return err
+	}
+	lower, err := d.lower.Readdir(0)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	entries := []os.FileInfo{}
+	for _, fi := range upper {
+		seen[fi.Name()] = true
+		entries = append(entries, fi)
+	}
+	for _, fi := range lower {
+		if !seen[fi.Name()] {
+			entries = append(entries, fi)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	d.entries = entries
+	return nil
+}
@@ -0,0 +1,82 @@
+package ghfs
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	_, upper := newRepo(t, map[string]string{
+		"docs/a":       "upper a",
+		"docs/sub/u":   "u",
+		"new/n":        "n",
+		"fileInUpper":  "file",
+		"dirInUpper/x": "x",
+	})
+	_, lower := newRepo(t, map[string]string{
+		"docs/a":        "lower a",
+		"docs/b":        "b",
+		"docs/sub/l":    "l",
+		"docs/sub/deep": "deep",
+		"only/lo":       "lo",
+		"fileInUpper/y": "y",
+		"dirInUpper":    "file",
+	})
+	hfs := Overlay(FromCommit(upper), FromCommit(lower))
+
+	listings := []struct {
+		dir  string
+		want []string
+	}{
+		{"/", []string{"dirInUpper", "docs", "fileInUpper", "new", "only"}},
+		// Overlapping directories are merged, recursively
+		{"/docs", []string{"a", "b", "sub"}},
+		{"/docs/sub", []string{"deep", "l", "u"}},
+		// Disjoint directories are listed from their tree
+		{"/new", []string{"n"}},
+		{"/only", []string{"lo"}},
+		// Entries of upper shadow lower ones of another type
+		{"/dirInUpper", []string{"x"}},
+	}
+	for _, test := range listings {
+		if names := readdirnames(t, hfs, test.dir); !reflect.DeepEqual(names, test.want) {
+			t.Errorf("Readdir of %s = %v, want %v", test.dir, names, test.want)
+		}
+	}
+
+	files := map[string]string{
+		"docs/a":        "upper a",
+		"docs/b":        "b",
+		"docs/sub/l":    "l",
+		"docs/sub/u":    "u",
+		"docs/sub/deep": "deep",
+		"only/lo":       "lo",
+		"fileInUpper":   "file",
+		"dirInUpper/x":  "x",
+	}
+	fsys := FS(hfs)
+	for name, want := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil || string(data) != want {
+			t.Errorf("ReadFile(%s) = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if _, err := fsys.Open("fileInUpper/y"); err == nil {
+		t.Error("fileInUpper/y of lower is not shadowed by the file of upper")
+	}
+
+	// The merged entry of a file in both reports the FileInfo of upper
+	d, err := hfs.Open("/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fis[0].Name() != "a" || fis[0].Size() != int64(len("upper a")) {
+		t.Errorf("entry a = %s of %d bytes, want the one of upper", fis[0].Name(), fis[0].Size())
+	}
+}
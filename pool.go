@@ -0,0 +1,24 @@
+package ghfs
+
+import (
+	"io"
+	"sync"
+)
+
+const copyBufferSize = 32 << 10
+
+// Buffers for copying and skipping blob data, so streaming a blob doesn't
+// allocate per request
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// Like io.Copy, but with a pooled buffer
+func copyBuffer(w io.Writer, r io.Reader) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	return io.CopyBuffer(w, r, *buf)
+}
@@ -0,0 +1,56 @@
+package ghfs
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serve a blob of size bytes through Handler, the whole blob or the range
+// rng. Blobs above 4 MiB are streamed, smaller ones buffered. Run with
+// -benchmem, allocations of the streamed path shouldn't grow with size
+func benchmarkServe(b *testing.B, size int, rng string) {
+	_, commit := newRepo(b, map[string]string{"blob": blobContent(size)})
+	h := Handler(FromCommit(commit))
+	r := httptest.NewRequest("GET", "/blob", nil)
+	if rng != "" {
+		r.Header.Set("Range", rng)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := &discardWriter{header: http.Header{}}
+		h.ServeHTTP(w, r)
+		if w.status != http.StatusOK && w.status != http.StatusPartialContent {
+			b.Fatalf("status %d", w.status)
+		}
+	}
+}
+
+func BenchmarkServe1M(b *testing.B)      { benchmarkServe(b, 1<<20, "") }
+func BenchmarkServe8M(b *testing.B)      { benchmarkServe(b, 8<<20, "") }
+func BenchmarkServe64M(b *testing.B)     { benchmarkServe(b, 64<<20, "") }
+func BenchmarkServe8MRange(b *testing.B) { benchmarkServe(b, 8<<20, "bytes=7000000-7000100") }
+
+// Skip into a streamed blob, which goes through the pooled buffers
+func BenchmarkSeekStreamed(b *testing.B) {
+	_, commit := newRepo(b, map[string]string{"blob": blobContent(8 << 20)})
+	hfs := FromCommit(commit)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := hfs.Open("/blob")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := f.Seek(6<<20, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.CopyN(ioutil.Discard, f, 10); err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,145 @@
+package ghfs
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Content codings of precompressed siblings in order of preference
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Serve a precompressed sibling like app.js.br or app.js.gz instead of
+// app.js if the client accepts its encoding. The response gets the
+// Content-Type of the uncompressed file
+func WithPrecompressed() HandlerOption {
+	return func(h *handler) {
+		h.precompressed = true
+	}
+}
+
+// Serve the preferred precompressed sibling of the file at name. Reports
+// false if nothing was written
+func (h *handler) servePrecompressed(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) bool {
+	for _, pc := range precompressed {
+		f, err := fs.Open(name + pc.ext)
+		if err != nil {
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			f.Close()
+			continue
+		}
+
+		// The response depends on Accept-Encoding as soon as there is
+		// a sibling
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsEncoding(r, pc.encoding) {
+			f.Close()
+			continue
+		}
+
+		defer f.Close()
+		// The headers of name, but the blob of the sibling
+		h.setHeaders(w, r, fs, name)
+		h.setBlobHeaders(w, fs, name+pc.ext)
+		if r.Method == http.MethodHead {
+			h.setHeadContentType(w, fs, name)
+		} else if ctype, ok := h.contentType(fs, name); ok {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.Header().Set("Content-Encoding", pc.encoding)
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+		return true
+	}
+	return false
+}
+
+// Content-Type of the file at name for the response to r. Like
+// contentType, but HEAD requests only get a known type
+func (h *handler) responseType(r *http.Request, fs http.FileSystem, name string) (string, bool) {
+	if r.Method == http.MethodHead {
+		return h.knownType(fs, name)
+	}
+	return h.contentType(fs, name)
+}
+
+// Content-Type of the file at name from the gitattributes, the extension
+// or the content, like http.ServeContent would
+func (h *handler) contentType(fs http.FileSystem, name string) (string, bool) {
+	if ct, ok := h.knownType(fs, name); ok {
+		return ct, true
+	}
+
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", false
+	}
+	return http.DetectContentType(buf[:n]), true
+}
+
+// Content-Type of the file at name from the gitattributes or the
+// extension, without reading the file. Reports false if only its content
+// can tell
+func (h *handler) knownType(fs http.FileSystem, name string) (string, bool) {
+	if h.attrs != nil {
+		if ct, ok := h.attrs.get(fs, name, ContentTypeAttribute); ok {
+			return ct, true
+		}
+	}
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct, true
+	}
+	return "", false
+}
+
+// Set the Content-Type of a HEAD response for the file at name without
+// reading it. http.ServeContent would sniff the content if the type is
+// unknown, so it is omitted then, as RFC 9110 allows for HEAD
+func (h *handler) setHeadContentType(w http.ResponseWriter, fs http.FileSystem, name string) {
+	if ct, ok := h.knownType(fs, name); ok {
+		w.Header().Set("Content-Type", ct)
+		return
+	}
+	w.Header()["Content-Type"] = nil
+}
+
+// Report whether the Accept-Encoding header of r allows encoding. An
+// explicit coding takes precedence over "*"
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	wildcard := false
+	for _, accept := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(accept, ";")
+		coding = strings.TrimSpace(coding)
+		if coding != encoding && coding != "*" {
+			continue
+		}
+
+		ok := true
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			v, err := strconv.ParseFloat(q, 64)
+			ok = err == nil && v > 0
+		}
+		if coding == encoding {
+			return ok
+		}
+		wildcard = ok
+	}
+	return wildcard
+}
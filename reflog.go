@@ -0,0 +1,79 @@
+package ghfs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// Returned when a ref has no reflog, like the branches of most bare
+// repositories
+var ErrNoReflog = errors.New("No reflog")
+
+// Serve git tree of the commit a branch or HEAD pointed to n updates ago,
+// like ref@{n} of git. Fails with ErrNoReflog if the ref has no reflog and
+// with ErrNoSuchRef if it has less than n+1 entries
+func FromReflog(repo *g.Repository, ref string, n int, opts ...Option) (http.FileSystem, error) {
+	if ref != "HEAD" && !repo.IsBranchExist(ref) {
+		return nil, errors.Wrap(ErrNoSuchBranch, ref)
+	}
+	id, err := reflogEntry(repo, ref, n)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.GetCommit(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot get commit of reflog entry.")
+	}
+	return FromCommit(commit, opts...), nil
+}
+
+// Return the new object id of the nth newest entry of the reflog of ref
+func reflogEntry(repo *g.Repository, ref string, n int) (string, error) {
+	file := filepath.Join(gitDir(repo), "logs", "HEAD")
+	if ref != "HEAD" {
+		file = filepath.Join(gitDir(repo), "logs", "refs", "heads", filepath.FromSlash(ref))
+	}
+	data, err := ioutil.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+		return "", errors.Wrap(ErrNoReflog, ref)
+	case err != nil:
+		return "", errors.Wrap(err, "Cannot read reflog.")
+	}
+
+	var lines []string
+	if log := strings.TrimRight(string(data), "\n"); log != "" {
+		lines = strings.Split(log, "\n")
+	}
+	if n < 0 || n >= len(lines) {
+		return "", errors.Wrapf(ErrNoSuchRef, "%s@{%d}, the reflog has %d entries", ref, n, len(lines))
+	}
+
+	// <old id> <new id> <committer> <time> <zone>\t<message>
+	fields := strings.Fields(lines[len(lines)-1-n])
+	if len(fields) < 2 || len(fields[1]) != fullIdLen {
+		return "", errors.Errorf("Invalid reflog entry %d of %s.", n, ref)
+	}
+	return fields[1], nil
+}
+
+// Split a revision like master@{3} into ref and reflog index
+func parseReflogRef(rev string) (string, int, bool) {
+	i := strings.LastIndex(rev, "@{")
+	if i <= 0 || !strings.HasSuffix(rev, "}") {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(rev[i+2 : len(rev)-1])
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	return rev[:i], n, true
+}
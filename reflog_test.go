@@ -0,0 +1,82 @@
+package ghfs
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFromReflog(t *testing.T) {
+	f, first := newRepo(t, map[string]string{"a": "0"})
+	f.write("a", "1")
+	second := f.commit("Second")
+	f.write("a", "2")
+	third := f.commit("Third")
+	f.git("checkout", "-q", "-b", "other", first.Id.String())
+	repo := f.repo()
+
+	for _, test := range []struct {
+		ref  string
+		want string
+	}{
+		{"master@{0}", third.Id.String()},
+		{"master@{1}", second.Id.String()},
+		{"master@{2}", first.Id.String()},
+		// HEAD also moved to other
+		{"HEAD@{0}", first.Id.String()},
+		{"HEAD@{1}", third.Id.String()},
+		{"other@{0}", first.Id.String()},
+	} {
+		hfs, err := FromRef(repo, test.ref)
+		if err != nil {
+			t.Errorf("%s: %v", test.ref, err)
+			continue
+		}
+		if id := hfs.(GitFileSystem).Commit().Id.String(); id != test.want {
+			t.Errorf("%s: got commit %s, want %s", test.ref, id, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		ref string
+		n   int
+		err error
+	}{
+		{"master", 3, ErrNoSuchRef},
+		{"other", 1, ErrNoSuchRef},
+		{"master", -1, ErrNoSuchRef},
+		{"nope", 0, ErrNoSuchBranch},
+	} {
+		if _, err := FromReflog(repo, test.ref, test.n); errors.Cause(err) != test.err {
+			t.Errorf("%s@{%d}: got %v, want %v", test.ref, test.n, err, test.err)
+		}
+	}
+	if _, err := FromReflog(f.bare(), "master", 0); errors.Cause(err) != ErrNoReflog {
+		t.Errorf("bare repository: got %v, want %v", err, ErrNoReflog)
+	}
+}
+
+func TestParseReflogRef(t *testing.T) {
+	for _, test := range []struct {
+		rev string
+		ref string
+		n   int
+		ok  bool
+	}{
+		{"master@{3}", "master", 3, true},
+		{"HEAD@{0}", "HEAD", 0, true},
+		{"feature/x@{12}", "feature/x", 12, true},
+		{"a@{b}@{1}", "a@{b}", 1, true},
+		{"master", "", 0, false},
+		{"@{1}", "", 0, false},
+		{"master@{-1}", "", 0, false},
+		{"master@{x}", "", 0, false},
+		{"master@{1", "", 0, false},
+		{"master@{}", "", 0, false},
+	} {
+		ref, n, ok := parseReflogRef(test.rev)
+		if ref != test.ref || n != test.n || ok != test.ok {
+			t.Errorf("parseReflogRef(%q) = %q, %d, %v, want %q, %d, %v", test.rev, ref, n, ok, test.ref, test.n, test.ok)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package ghfs
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// Generate a sitemap.xml listing the .html files of fs below baseURL, with
+// their ModTime as lastmod. index.html files are listed as their
+// directory. Files and directories starting with "." are skipped, as are
+// the paths fs hides, e.g. with WithHiddenPrefix, WithAllow or WithDeny
+func Sitemap(fs http.FileSystem, baseURL string) ([]byte, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	set := sitemapURLSet{URLs: []sitemapURL{}}
+	err := Walk(fs, "/", func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(fi.Name(), ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() || path.Ext(name) != ".html" {
+			return nil
+		}
+
+		if path.Base(name) == "index.html" {
+			name = strings.TrimSuffix(name, "index.html")
+		}
+		u := sitemapURL{Loc: baseURL + (&url.URL{Path: name}).EscapedPath()}
+		if t := fi.ModTime(); !t.IsZero() {
+			u.LastMod = t.UTC().Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
@@ -0,0 +1,66 @@
+package ghfs
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestSitemap(t *testing.T) {
+	f, _ := newRepo(t, map[string]string{
+		"index.html":      "i",
+		"about.html":      "a",
+		"docs/index.html": "d",
+		"docs/a b.html":   "ab",
+		"style.css":       "s",
+		"page.htm":        "p",
+		".hidden/x.html":  "x",
+		".x.html":         "x",
+		"secret/s.html":   "s",
+		"link.html@":      "index.html",
+	})
+	f.write("docs/new.html", "n")
+	commit := f.commit("Add docs/new.html")
+
+	hfs := FromCommit(commit, WithDeny("secret"), WithLastChangeModTime())
+	got, err := Sitemap(hfs, "https://example.com/site/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// In the order of Walk, index.html as its directory
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://example.com/site/about.html</loc>
+    <lastmod>2017-06-01T12:00:00Z</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/site/docs/a%20b.html</loc>
+    <lastmod>2017-06-01T12:00:00Z</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/site/docs/</loc>
+    <lastmod>2017-06-01T12:00:00Z</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/site/docs/new.html</loc>
+    <lastmod>2017-06-01T13:00:00Z</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/site/</loc>
+    <lastmod>2017-06-01T12:00:00Z</lastmod>
+  </url>
+</urlset>
+`
+	if string(got) != want {
+		t.Errorf("Sitemap =\n%s\nwant\n%s", got, want)
+	}
+
+	// An empty tree has an empty urlset
+	got, err = Sitemap(FromCommit(newFixture(t).commit("Empty")), "https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := xml.Header + `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"></urlset>` + "\n"; string(got) != want {
+		t.Errorf("Sitemap of empty tree = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,68 @@
+package ghfs
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type subfs struct {
+	fs  http.FileSystem
+	dir string
+}
+
+// Serve the subdirectory dir of fs. Paths escaping dir are rejected
+func Sub(fs http.FileSystem, dir string) (http.FileSystem, error) {
+	dir, ok := cleanPath(dir)
+	if !ok {
+		return nil, errors.Errorf("Invalid directory %q", dir)
+	}
+
+	f, err := fs.Open("/" + dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open directory.")
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot stat directory.")
+	}
+	if !fi.IsDir() {
+		return nil, errors.Errorf("%q is not a directory", dir)
+	}
+
+	return subfs{fs, dir}, nil
+}
+
+func (s subfs) Open(name string) (http.File, error) {
+	clean, ok := cleanPath(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: clean, Err: os.ErrNotExist}
+	}
+	return s.fs.Open(withSlash(name, "/"+path.Join(s.dir, clean)))
+}
+
+// Clean a slash separated path relative to the root. Report false if the
+// path escapes the root
+func cleanPath(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return name, false
+	}
+	if name == "." {
+		name = ""
+	}
+	return name, true
+}
+
+// Append a slash to the cleaned path if name has a trailing slash, which
+// only matches directories
+func withSlash(name, clean string) string {
+	if strings.HasSuffix(name, "/") && !strings.HasSuffix(clean, "/") {
+		return clean + "/"
+	}
+	return clean
+}
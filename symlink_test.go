@@ -0,0 +1,161 @@
+package ghfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSymlink(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a.txt": "a", "run*": "#!", "link@": "a.txt", "dir/l@": "../a.txt"})
+	hfs := FromCommit(commit)
+	gfs := hfs.(GitFileSystem)
+
+	for _, test := range []struct {
+		name    string
+		mode    os.FileMode
+		content string
+	}{
+		{"/a.txt", 0644, "a"},
+		{"/run", 0755, "#!"},
+		// Served with the target as content
+		{"/link", os.ModeSymlink | 0777, "a.txt"},
+		{"/dir/l", os.ModeSymlink | 0777, "../a.txt"},
+	} {
+		f, err := hfs.Open(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.Mode() != test.mode || fi.Size() != int64(len(test.content)) {
+			t.Errorf("Stat of %s = %v, %v, want mode %v and size %d", test.name, fi.Mode(), err, test.mode, len(test.content))
+		}
+		if data, err := io.ReadAll(f); err != nil || string(data) != test.content {
+			t.Errorf("content of %s = %q, %v, want %q", test.name, data, err, test.content)
+		}
+
+		target, err := f.(Linker).Readlink()
+		fsTarget, fsErr := gfs.Readlink(test.name)
+		if test.mode&os.ModeSymlink == 0 {
+			if !errors.Is(err, os.ErrInvalid) || !errors.Is(fsErr, os.ErrInvalid) {
+				t.Errorf("Readlink of %s = %v, %v, want %v", test.name, err, fsErr, os.ErrInvalid)
+			}
+		} else if err != nil || fsErr != nil || target != test.content || fsTarget != test.content {
+			t.Errorf("Readlink of %s = %q, %v and %q, %v, want %q", test.name, target, err, fsTarget, fsErr, test.content)
+		}
+		f.Close()
+	}
+
+	// Listings report the mode too
+	d, err := hfs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		if symlink := fi.Mode()&os.ModeSymlink != 0; symlink != (fi.Name() == "link") {
+			t.Errorf("Readdir: %s has mode %v", fi.Name(), fi.Mode())
+		}
+	}
+
+	if _, err := gfs.Readlink("/nope"); !os.IsNotExist(err) {
+		t.Errorf("Readlink of missing file: got %v, want not exist", err)
+	}
+	for _, name := range []string{"/", "/dir"} {
+		if _, err := gfs.Readlink(name); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("Readlink of %s: got %v, want %v", name, err, os.ErrInvalid)
+		}
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	files := map[string]string{
+		"a.txt":     "a",
+		"dir/b.txt": "b",
+		"dir/up@":   "../a.txt",
+		"link@":     "a.txt",
+		"dirlink@":  "dir",
+		"loop@":     "loop",
+		"abs@":      "/a.txt",
+		"escape@":   "../a.txt",
+		"root@":     ".",
+		"h9@":       "h1",
+		"h8@":       "a.txt",
+	}
+	// h1 takes maxSymlinkHops links to resolve, h9 one more
+	for i := 1; i < maxSymlinkHops; i++ {
+		files[fmt.Sprintf("h%d@", i)] = fmt.Sprintf("h%d", i+1)
+	}
+	_, commit := newRepo(t, files)
+	hfs := FromCommit(commit, WithFollowSymlinks())
+
+	for _, test := range []struct {
+		name    string
+		content string
+	}{
+		{"/link", "a"},
+		{"/dirlink/b.txt", "b"},
+		{"/dirlink/up", "a"},
+		{"/h1", "a"},
+		{"/h9", ""},
+		{"/loop", ""},
+		{"/loop/a.txt", ""},
+		{"/abs", ""},
+		{"/escape", ""},
+		{"/root", ""},
+		{"/root/a.txt", ""},
+	} {
+		f, err := hfs.Open(test.name)
+		if test.content == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("Open of %s = %v, want not exist", test.name, err)
+			}
+			if err == nil {
+				f.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Open of %s = %v", test.name, err)
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.Mode() != 0644 {
+			t.Errorf("Stat of %s = %v, %v, want mode %v of the target", test.name, fi.Mode(), err, os.FileMode(0644))
+		}
+		if data, err := io.ReadAll(f); err != nil || string(data) != test.content {
+			t.Errorf("content of %s = %q, %v, want %q", test.name, data, err, test.content)
+		}
+		f.Close()
+	}
+
+	if fi, ok := stat(hfs, "/dirlink"); !ok || !fi.IsDir() {
+		t.Errorf("Stat of /dirlink = %v, want a directory", fi)
+	}
+
+	// Readlink resolves the parents, but not the link itself
+	gfs := hfs.(GitFileSystem)
+	for _, test := range []struct {
+		name   string
+		target string
+	}{
+		{"/link", "a.txt"},
+		{"/loop", "loop"},
+		{"/abs", "/a.txt"},
+		{"/dirlink/up", "../a.txt"},
+	} {
+		if target, err := gfs.Readlink(test.name); err != nil || target != test.target {
+			t.Errorf("Readlink of %s = %q, %v, want %q", test.name, target, err, test.target)
+		}
+	}
+	if _, err := gfs.Readlink("/a.txt"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("Readlink of /a.txt: got %v, want %v", err, os.ErrInvalid)
+	}
+}
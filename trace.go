@@ -0,0 +1,75 @@
+package ghfs
+
+import (
+	"context"
+	"io"
+)
+
+// Starts spans around git object access, e.g. as adapter to OpenTelemetry.
+// Spans are started for Open ("ghfs.Open"), the lookup of the tree entry
+// ("ghfs.lookup") and the reading of blob data ("ghfs.readBlob"), which
+// ends when the blob reader is closed. Tracers must be safe for concurrent
+// use
+type Tracer interface {
+	// Start a span named op as a child of the span in ctx
+	Start(ctx context.Context, op string) (context.Context, Span)
+}
+
+// A span started by a Tracer
+type Span interface {
+	// Attach an attribute, "ghfs.path", "ghfs.sha" or "ghfs.size"
+	SetAttribute(key string, value interface{})
+	// End the span. err is the error of the traced operation, if any
+	End(err error)
+}
+
+// Trace Open, lookups and blob reads with tracer. Without this option no
+// spans are started
+func WithTracer(tracer Tracer) Option {
+	return func(fs *ghfs) {
+		fs.tracer = tracer
+	}
+}
+
+type noopTracer struct{}
+type noopSpan struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+// Start a span with tracer, which may be nil
+func startSpan(tracer Tracer, ctx context.Context, op string) (context.Context, Span) {
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer.Start(ctx, op)
+}
+
+// Ends its span on Close with the first error other than io.EOF
+type spanReader struct {
+	io.ReadCloser
+	span Span
+	err  error
+}
+
+func (r *spanReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+func (r *spanReader) Close() error {
+	err := r.ReadCloser.Close()
+	if r.err == nil {
+		r.err = err
+	}
+	r.span.End(r.err)
+	return err
+}
@@ -0,0 +1,124 @@
+package ghfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	op     string
+	parent string
+	attrs  map[string]interface{}
+	ended  bool
+	err    error
+}
+
+// Records all spans with the op of their parent
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (tr *recordingTracer) Start(ctx context.Context, op string) (context.Context, Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	s := &recordedSpan{op: op, attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.op
+	}
+	tr.spans = append(tr.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), recordingSpan{tr, s}
+}
+
+// Return the recorded spans and start over
+func (tr *recordingTracer) take() []*recordedSpan {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	spans := tr.spans
+	tr.spans = nil
+	return spans
+}
+
+type recordingSpan struct {
+	tr *recordingTracer
+	s  *recordedSpan
+}
+
+func (s recordingSpan) SetAttribute(key string, value interface{}) {
+	s.tr.mu.Lock()
+	defer s.tr.mu.Unlock()
+	s.s.attrs[key] = value
+}
+func (s recordingSpan) End(err error) {
+	s.tr.mu.Lock()
+	defer s.tr.mu.Unlock()
+	s.s.ended = true
+	s.s.err = err
+}
+
+func TestTracer(t *testing.T) {
+	f, commit := newRepo(t, map[string]string{"d/a.txt": "abc"})
+	sha := f.git("rev-parse", "HEAD:d/a.txt")
+	tr := &recordingTracer{}
+	hfs := FromCommit(commit, WithTracer(tr))
+
+	ctx, _ := tr.Start(context.Background(), "request")
+	tr.take()
+	file, err := hfs.(ContextFileSystem).OpenContext(ctx, "/d/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := tr.take()
+	want := []*recordedSpan{
+		{op: "ghfs.Open", parent: "request", attrs: map[string]interface{}{"ghfs.path": "/d/a.txt", "ghfs.sha": sha, "ghfs.size": int64(3)}, ended: true},
+		{op: "ghfs.lookup", parent: "ghfs.Open", attrs: map[string]interface{}{"ghfs.path": "d/a.txt"}, ended: true},
+	}
+	if !reflect.DeepEqual(spans, want) {
+		t.Errorf("spans of OpenContext = %+v, want %+v", spans, want)
+	}
+
+	if _, err := io.ReadAll(file); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	spans = tr.take()
+	want = []*recordedSpan{
+		{op: "ghfs.readBlob", parent: "request", attrs: map[string]interface{}{"ghfs.sha": sha, "ghfs.size": int64(3)}, ended: true},
+	}
+	if !reflect.DeepEqual(spans, want) {
+		t.Errorf("spans of Read and Close = %+v, want %+v", spans, want)
+	}
+
+	// Failed lookups end their spans with the error
+	if _, err := hfs.Open("/nope"); !os.IsNotExist(err) {
+		t.Fatalf("Open of /nope = %v, want not exist", err)
+	}
+	spans = tr.take()
+	if len(spans) != 2 {
+		t.Fatalf("spans of a failed Open = %+v, want ghfs.Open and ghfs.lookup", spans)
+	}
+	for _, s := range spans {
+		if !s.ended || !os.IsNotExist(s.err) {
+			t.Errorf("%s of /nope ended %v with %v, want not exist", s.op, s.ended, s.err)
+		}
+	}
+	if spans[0].parent != "" {
+		t.Errorf("ghfs.Open without context has parent %s", spans[0].parent)
+	}
+
+	// The root needs no lookup
+	d, err := hfs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	if spans := tr.take(); len(spans) != 1 || spans[0].op != "ghfs.Open" {
+		t.Errorf("spans of Open of / = %+v, want only ghfs.Open", spans)
+	}
+}
@@ -0,0 +1,69 @@
+package ghfs
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// Walk the tree of fs rooted at root like filepath.Walk, calling fn for
+// each file and directory in lexical order. Names passed to fn are
+// absolute paths of fs. Returning filepath.SkipDir from fn skips the
+// directory, or for files the rest of their directory
+func Walk(fs http.FileSystem, root string, fn func(name string, fi os.FileInfo, err error) error) error {
+	root = path.Clean("/" + root)
+	fi, err := statErr(fs, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fs, root, fi, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkDir(fs http.FileSystem, name string, fi os.FileInfo, fn func(string, os.FileInfo, error) error) error {
+	if err := fn(name, fi, nil); err != nil || !fi.IsDir() {
+		return err
+	}
+
+	fis, err := readDir(fs, name)
+	if err != nil {
+		return fn(name, fi, err)
+	}
+	for _, child := range fis {
+		err := walkDir(fs, path.Join(name, child.Name()), child, fn)
+		if err != nil && !(err == filepath.SkipDir && child.IsDir()) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read the directory at name sorted by name
+func readDir(fs http.FileSystem, name string) ([]os.FileInfo, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fis, err := f.Readdir(-1)
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Name() < fis[j].Name()
+	})
+	return fis, err
+}
+
+func statErr(fs http.FileSystem, name string) (os.FileInfo, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
@@ -0,0 +1,58 @@
+package ghfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWalk(t *testing.T) {
+	_, commit := newRepo(t, map[string]string{"a": "", "b/c": "", "b/d/e": "", "b/f": "", "g": ""})
+	hfs := FromCommit(commit)
+	errStop := errors.New("stop")
+
+	for _, test := range []struct {
+		name string
+		root string
+		// Returned by fn for the name
+		skip map[string]error
+		want []string
+		err  error
+	}{
+		{"all", "/", nil, []string{"/", "/a", "/b", "/b/c", "/b/d", "/b/d/e", "/b/f", "/g"}, nil},
+		{"subtree", "b/d", nil, []string{"/b/d", "/b/d/e"}, nil},
+		{"SkipDir of a directory", "/", map[string]error{"/b/d": filepath.SkipDir}, []string{"/", "/a", "/b", "/b/c", "/b/d", "/b/f", "/g"}, nil},
+		// Skips the rest of the directory of the file
+		{"SkipDir of a file", "/", map[string]error{"/b/c": filepath.SkipDir}, []string{"/", "/a", "/b", "/b/c", "/g"}, nil},
+		{"SkipDir of the root", "/", map[string]error{"/": filepath.SkipDir}, []string{"/"}, nil},
+		{"error", "/", map[string]error{"/b/d": errStop}, []string{"/", "/a", "/b", "/b/c", "/b/d"}, errStop},
+	} {
+		var got []string
+		err := Walk(hfs, test.root, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			got = append(got, name)
+			return test.skip[name]
+		})
+		if err != test.err || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: walked %q, %v, want %q, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+
+	// A missing root is passed to fn
+	var walkErr error
+	err := Walk(hfs, "/nope", func(name string, fi os.FileInfo, err error) error {
+		if name != "/nope" || fi != nil {
+			t.Errorf("Walk of missing root: called with %s, %v", name, fi)
+		}
+		walkErr = err
+		return err
+	})
+	if !os.IsNotExist(err) || !os.IsNotExist(walkErr) {
+		t.Errorf("Walk of missing root = %v, fn got %v, want not exist", err, walkErr)
+	}
+}
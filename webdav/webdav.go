@@ -0,0 +1,69 @@
+// Serve a http.FileSystem, like the ones of ghfs, read-only over WebDAV.
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"syscall"
+
+	"github.com/lemmi/ghfs"
+	"golang.org/x/net/webdav"
+)
+
+// Expose a http.FileSystem as read-only webdav.FileSystem. Writes fail
+// with syscall.EROFS. If hfs is a ghfs.ContextFileSystem, reads are
+// cancelled with the request. To serve a commit read-only:
+//
+//	http.Handle("/", &webdav.Handler{
+//		FileSystem: ghfswebdav.New(ghfs.FromCommit(commit)),
+//		LockSystem: webdav.NewMemLS(),
+//	})
+func New(hfs http.FileSystem) webdav.FileSystem {
+	return davfs{hfs}
+}
+
+type davfs struct {
+	hfs http.FileSystem
+}
+
+func readOnly(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: syscall.EROFS}
+}
+
+func (d davfs) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, readOnly("open", name)
+	}
+	f, err := ghfs.WithContext(ctx, d.hfs).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return davFile{File: f, name: name}, nil
+}
+func (d davfs) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	f, err := ghfs.WithContext(ctx, d.hfs).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+func (d davfs) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return readOnly("mkdir", name)
+}
+func (d davfs) RemoveAll(ctx context.Context, name string) error {
+	return readOnly("remove", name)
+}
+func (d davfs) Rename(ctx context.Context, oldName, newName string) error {
+	return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: syscall.EROFS}
+}
+
+type davFile struct {
+	http.File
+	name string
+}
+
+func (f davFile) Write([]byte) (int, error) {
+	return 0, readOnly("write", f.name)
+}
@@ -0,0 +1,65 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestWebDAV(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "d", "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dav := New(http.Dir(dir))
+	h := &webdav.Handler{FileSystem: dav, LockSystem: webdav.NewMemLS()}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PROPFIND", "/", nil)
+	r.Header.Set("Depth", "1")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "/d/") {
+		t.Errorf("PROPFIND / = %d:\n%s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/d/b.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "b" {
+		t.Errorf("GET /d/b.txt = %d, %q", w.Code, w.Body)
+	}
+
+	for _, method := range []string{"PUT", "MKCOL", "DELETE"} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/d/b.txt", strings.NewReader("x")))
+		if w.Code < 400 {
+			t.Errorf("%s /d/b.txt = %d, want an error", method, w.Code)
+		}
+	}
+
+	ctx := context.Background()
+	writes := map[string]error{
+		"OpenFile":  func() error { _, err := dav.OpenFile(ctx, "/d/b.txt", os.O_WRONLY, 0); return err }(),
+		"Mkdir":     dav.Mkdir(ctx, "/e", 0755),
+		"RemoveAll": dav.RemoveAll(ctx, "/d"),
+		"Rename":    dav.Rename(ctx, "/d", "/e"),
+	}
+	for op, err := range writes {
+		if !errors.Is(err, syscall.EROFS) {
+			t.Errorf("%s: got %v, want %v", op, err, syscall.EROFS)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "d", "b.txt")); err != nil || string(data) != "b" {
+		t.Errorf("b.txt was modified: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,38 @@
+package ghfs
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	g "github.com/gogits/git"
+)
+
+// Returned by FromWorkTree for bare repositories and repositories opened
+// at their .git directory
+var ErrBareRepository = errors.New("Repository has no working tree")
+
+// Serve the working tree of repo as it is on disk, including uncommitted
+// and untracked files, e.g. to preview changes before committing them.
+// Every Open reads the current state of the file. The .git directory is
+// not served, paths are cleaned like for the other filesystems and
+// symlinks are followed by the operating system, also out of the working
+// tree. Ignored files are served as well. Linked worktrees and
+// submodules, where .git is a file pointing to the git directory, are
+// served like any other working tree
+func FromWorkTree(repo *g.Repository) (http.FileSystem, error) {
+	if _, err := os.Lstat(filepath.Join(repo.Path, ".git")); err != nil {
+		return nil, errors.Wrap(ErrBareRepository, repo.Path)
+	}
+	return filterfs{
+		fs: http.Dir(repo.Path),
+		keep: func(name string, _ os.FileInfo) bool {
+			// Also hide .GIT on case-insensitive filesystems
+			first, _, _ := strings.Cut(name, "/")
+			return !strings.EqualFold(first, ".git")
+		},
+	}, nil
+}